@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"go.githedgehog.com/dasboot/pkg/seeder/pki"
 	"gopkg.in/yaml.v3"
 )
 
@@ -20,6 +21,123 @@ type Config struct {
 	// InstallerSettings are various settings that are being used in configurations that are being sent to clients through
 	// embedded configurations.
 	InstallerSettings *InstallerSettings `json:"installer_settings,omitempty" yaml:"installer_settings,omitempty"`
+
+	// PKI enables the built-in embedded PKI. When set, the seeder will generate or load its own root and
+	// intermediate CA under PKI.DataDir, and use them to mint and rotate the server and embedded-config
+	// signing certificates automatically, as well as to enroll switches with their own client
+	// certificates. When this is set, the key/cert path fields elsewhere in this Config become optional
+	// overrides rather than requirements.
+	PKI *pki.Config `json:"pki,omitempty" yaml:"pki,omitempty"`
+
+	// ArtifactProviders configures where NOS and installer artifacts are pulled from, keyed by the name that
+	// is referenced from the rest of the configuration.
+	ArtifactProviders map[string]*ArtifactProviderConfig `json:"artifact_providers,omitempty" yaml:"artifact_providers,omitempty"`
+
+	// ArtifactPublishers configures where staged installer bundles are pushed to, keyed by the name that is
+	// referenced from the rest of the configuration.
+	ArtifactPublishers map[string]*ArtifactPublisherConfig `json:"artifact_publishers,omitempty" yaml:"artifact_publishers,omitempty"`
+
+	// Credentials configures how artifact providers and publishers authenticate against registries, beyond
+	// whatever inline username/password/token fields they carry.
+	Credentials *CredentialsConfig `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+}
+
+// CredentialsConfig configures the credential stores that artifact providers and publishers draw from.
+type CredentialsConfig struct {
+	// Static configures fixed credentials per registry host, for seeders that talk to more than one
+	// registry.
+	Static map[string]StaticCredential `json:"static,omitempty" yaml:"static,omitempty"`
+
+	// DockerConfigPath points to a Docker-style config.json (as produced by `docker login`) to source
+	// credentials from.
+	DockerConfigPath string `json:"docker_config_path,omitempty" yaml:"docker_config_path,omitempty"`
+}
+
+// StaticCredential is a single statically configured registry credential. Either Username/Password, or one
+// of AccessToken/RefreshToken, should be set.
+type StaticCredential struct {
+	Username     string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password     string `json:"password,omitempty" yaml:"password,omitempty"`
+	AccessToken  string `json:"access_token,omitempty" yaml:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty" yaml:"refresh_token,omitempty"`
+}
+
+// ArtifactProviderConfig configures a single ORAS artifact provider. It is the YAML representation of the
+// `oras.ProviderOption`s that are available in code.
+type ArtifactProviderConfig struct {
+	// RegistryURL is the OCI registry to pull artifacts from, e.g. `oci://registry.example.com/hedgehog`.
+	RegistryURL string `json:"registry_url,omitempty" yaml:"registry_url,omitempty"`
+
+	// FileStoreBasePath is the local directory which is used to stage downloaded artifacts.
+	FileStoreBasePath string `json:"file_store_base_path,omitempty" yaml:"file_store_base_path,omitempty"`
+
+	// ServerCAPath points to a file containing one or more CA certificates that the registry's TLS server
+	// certificate will be validated against, instead of the system trust store.
+	ServerCAPath string `json:"server_ca,omitempty" yaml:"server_ca,omitempty"`
+
+	// ClientCertPath and ClientKeyPath configure a client certificate which is presented to the registry,
+	// enabling mutual TLS. Both must be set for a client certificate to be used.
+	ClientCertPath string `json:"client_cert,omitempty" yaml:"client_cert,omitempty"`
+	ClientKeyPath  string `json:"client_key,omitempty" yaml:"client_key,omitempty"`
+
+	// Username and Password configure static basic auth credentials for the registry.
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+
+	// AccessToken and RefreshToken configure static OAuth2 tokens for the registry.
+	AccessToken  string `json:"access_token,omitempty" yaml:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty" yaml:"refresh_token,omitempty"`
+
+	// PlainHTTP disables TLS entirely and talks plain HTTP to the registry. This is only meant for on-prem
+	// or test registries that are not exposed beyond a trusted network.
+	PlainHTTP bool `json:"plain_http,omitempty" yaml:"plain_http,omitempty"`
+
+	// InsecureSkipVerify disables verification of the registry's TLS server certificate. This must only
+	// ever be used for testing.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+
+	// ArtifactPins maps an artifact name to the manifest digest it is expected to resolve to. Fetches
+	// which resolve to a different digest are refused.
+	ArtifactPins map[string]string `json:"artifact_pins,omitempty" yaml:"artifact_pins,omitempty"`
+
+	// VerificationKeyPaths lists PEM-encoded ECDSA public keys. When set, only artifacts with a valid
+	// cosign-style signature from one of these keys are served.
+	VerificationKeyPaths []string `json:"verification_keys,omitempty" yaml:"verification_keys,omitempty"`
+
+	// CacheSizeBytes bounds how large the on-disk artifact cache for this provider is allowed to grow.
+	// Once exceeded, the least recently used artifacts are evicted. 0 means unbounded.
+	CacheSizeBytes int64 `json:"cache_size_bytes,omitempty" yaml:"cache_size_bytes,omitempty"`
+
+	// CacheTTL bounds how long a cached artifact may go unused before it is re-fetched from the registry,
+	// expressed as a Go duration string (e.g. "24h"). Empty means cached artifacts never expire on their
+	// own.
+	CacheTTL string `json:"cache_ttl,omitempty" yaml:"cache_ttl,omitempty"`
+
+	// ArtifactMediaTypes maps an artifact name to the media type of the layer that should be served out of
+	// its (possibly multi-artifact) manifest, e.g. to tell an installer binary apart from its embedded
+	// config within the same manifest.
+	ArtifactMediaTypes map[string]string `json:"artifact_media_types,omitempty" yaml:"artifact_media_types,omitempty"`
+}
+
+// ArtifactPublisherConfig configures a single ORAS artifact publisher, which the seeder uses to push staged
+// installer bundles (installer binary, generated embedded config, and signature) into a registry, keyed by
+// switch identity.
+type ArtifactPublisherConfig struct {
+	// RegistryURL is the OCI registry to push artifacts to, e.g. `oci://registry.example.com/hedgehog/staged`.
+	RegistryURL string `json:"registry_url,omitempty" yaml:"registry_url,omitempty"`
+
+	// FileStoreBasePath is the local directory which is used to stage artifacts before they are pushed.
+	FileStoreBasePath string `json:"file_store_base_path,omitempty" yaml:"file_store_base_path,omitempty"`
+
+	// ServerCAPath, ClientCertPath/ClientKeyPath, Username/Password and PlainHTTP/InsecureSkipVerify mirror
+	// the same-named fields on ArtifactProviderConfig.
+	ServerCAPath       string `json:"server_ca,omitempty" yaml:"server_ca,omitempty"`
+	ClientCertPath     string `json:"client_cert,omitempty" yaml:"client_cert,omitempty"`
+	ClientKeyPath      string `json:"client_key,omitempty" yaml:"client_key,omitempty"`
+	Username           string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password           string `json:"password,omitempty" yaml:"password,omitempty"`
+	PlainHTTP          bool   `json:"plain_http,omitempty" yaml:"plain_http,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
 }
 
 type Servers struct {
@@ -44,21 +162,25 @@ type BindInfo struct {
 	// be required on the TLS server. This setting is ignored if no server key and certificate were provided.
 	ClientCAPath string `json:"client_ca,omitempty" yaml:"client_ca,omitempty"`
 
-	// ServerKeyPath points to a file containing the server key used for the TLS server. If this is empty,
-	// a plain HTTP server will be initiated.
+	// ServerKeyPath points to a file containing the server key used for the TLS server. If this is empty
+	// and PKI is not enabled, a plain HTTP server will be initiated. If PKI is enabled, this overrides the
+	// automatically minted server key.
 	ServerKeyPath string `json:"server_key,omitempty" yaml:"server_key,omitempty"`
 
 	// ServerCertPath points to a file containing the server certificate used for the TLS server. If `ServerKeyPath`
-	// is set, this setting is required to be set.
+	// is set, this setting is required to be set. If PKI is enabled, this overrides the automatically minted
+	// server certificate.
 	ServerCertPath string `json:"server_cert,omitempty" yaml:"server_cert,omitempty"`
 }
 
 type EmbeddedConfigGeneratorConfig struct {
 	// KeyPath points to a file which contains the key which is being used to sign embedded configuration.
+	// If PKI is enabled, this overrides the automatically minted signing key.
 	KeyPath string `json:"config_signature_key,omitempty" yaml:"config_signature_key,omitempty"`
 
 	// CertPath points to a certificate which is used to sign embedded configuration. Its public key must
-	// match the key from `KeyPath`.
+	// match the key from `KeyPath`. If PKI is enabled, this overrides the automatically minted signing
+	// certificate.
 	CertPath string `json:"config_signature_cert,omitempty" yaml:"config_signature_cert,omitempty"`
 }
 
@@ -110,6 +232,9 @@ var ReferenceConfig = Config{
 		KeyPath:  "/etc/hedgehog/seeder/embedded-config-generator-key.pem",
 		CertPath: "/etc/hedgehog/seeder/embedded-config-generator-cert.pem",
 	},
+	PKI: &pki.Config{
+		DataDir: "/var/lib/hedgehog/seeder/pki",
+	},
 	InstallerSettings: &InstallerSettings{
 		ServerCAPath:          "/etc/hedgehog/seeder/server-ca-cert.pem",
 		ConfigSignatureCAPath: "/etc/hedgehog/seeder/embedded-config-generator-ca-cert.pem",
@@ -118,6 +243,27 @@ var ReferenceConfig = Config{
 		NTPServers:            []string{"192.168.42.11", "192.168.42.12"},
 		SyslogServers:         []string{"192.168.42.11"},
 	},
+	ArtifactProviders: map[string]*ArtifactProviderConfig{
+		"nos": {
+			RegistryURL:       "oci://registry.example.com/hedgehog",
+			FileStoreBasePath: "/var/lib/hedgehog/seeder/artifacts",
+			ServerCAPath:      "/etc/hedgehog/seeder/registry-ca-cert.pem",
+		},
+	},
+	ArtifactPublishers: map[string]*ArtifactPublisherConfig{
+		"staged": {
+			RegistryURL:       "oci://registry.example.com/hedgehog/staged",
+			FileStoreBasePath: "/var/lib/hedgehog/seeder/staging",
+			ServerCAPath:      "/etc/hedgehog/seeder/registry-ca-cert.pem",
+		},
+	},
+	Credentials: &CredentialsConfig{
+		Static: map[string]StaticCredential{
+			"registry.example.com": {
+				RefreshToken: "<refresh-token>",
+			},
+		},
+	},
 }
 
 func marshalReferenceConfig() ([]byte, error) {
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.githedgehog.com/dasboot/pkg/seeder/artifacts"
+	"go.githedgehog.com/dasboot/pkg/seeder/artifacts/oras"
+	"go.githedgehog.com/dasboot/pkg/seeder/pki"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// Options translates this ArtifactProviderConfig into the oras.ProviderOptions that oras.Provider expects,
+// so that the YAML configuration actually drives how the provider talks to its registry. An error is
+// returned only if CacheTTL is set but cannot be parsed as a Go duration.
+func (c *ArtifactProviderConfig) Options() ([]oras.ProviderOption, error) {
+	var opts []oras.ProviderOption
+	if c.ServerCAPath != "" {
+		opts = append(opts, oras.WithServerCA(c.ServerCAPath))
+	}
+	if c.ClientCertPath != "" && c.ClientKeyPath != "" {
+		opts = append(opts, oras.WithClientCertificate(c.ClientCertPath, c.ClientKeyPath))
+	}
+	if c.Username != "" || c.Password != "" {
+		opts = append(opts, oras.WithCredentials(c.Username, c.Password))
+	}
+	if c.AccessToken != "" {
+		opts = append(opts, oras.WithAccessToken(c.AccessToken))
+	}
+	if c.RefreshToken != "" {
+		opts = append(opts, oras.WithRefreshToken(c.RefreshToken))
+	}
+	if c.PlainHTTP {
+		opts = append(opts, oras.WithPlainHTTP())
+	}
+	if c.InsecureSkipVerify {
+		opts = append(opts, oras.WithInsecureSkipVerify())
+	}
+	if len(c.ArtifactPins) > 0 {
+		opts = append(opts, oras.WithArtifactPins(c.ArtifactPins))
+	}
+	if len(c.VerificationKeyPaths) > 0 {
+		opts = append(opts, oras.WithVerificationKeys(c.VerificationKeyPaths...))
+	}
+	if c.CacheSizeBytes > 0 {
+		opts = append(opts, oras.WithCacheSize(c.CacheSizeBytes))
+	}
+	if c.CacheTTL != "" {
+		ttl, err := time.ParseDuration(c.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cache_ttl: %w", err)
+		}
+		opts = append(opts, oras.WithCacheTTL(ttl))
+	}
+	if len(c.ArtifactMediaTypes) > 0 {
+		opts = append(opts, oras.WithArtifactMediaTypes(c.ArtifactMediaTypes))
+	}
+	return opts, nil
+}
+
+// Options translates this ArtifactPublisherConfig into the oras.PublisherOptions that oras.NewPublisher
+// expects.
+func (c *ArtifactPublisherConfig) Options() []oras.PublisherOption {
+	var opts []oras.PublisherOption
+	if c.ServerCAPath != "" {
+		opts = append(opts, oras.WithPublisherServerCA(c.ServerCAPath))
+	}
+	if c.ClientCertPath != "" && c.ClientKeyPath != "" {
+		opts = append(opts, oras.WithPublisherClientCertificate(c.ClientCertPath, c.ClientKeyPath))
+	}
+	if c.Username != "" || c.Password != "" {
+		opts = append(opts, oras.WithPublisherCredentials(c.Username, c.Password))
+	}
+	if c.PlainHTTP {
+		opts = append(opts, oras.WithPublisherPlainHTTP())
+	}
+	if c.InsecureSkipVerify {
+		opts = append(opts, oras.WithPublisherInsecureSkipVerify())
+	}
+	return opts
+}
+
+// ArtifactPublisher builds the artifacts.Publisher configured under name in c.ArtifactPublishers, wiring in
+// c.Credentials as its CredentialStore when configured.
+func (c *Config) ArtifactPublisher(ctx context.Context, name string) (artifacts.Publisher, error) {
+	pc, ok := c.ArtifactPublishers[name]
+	if !ok {
+		return nil, fmt.Errorf("no artifact publisher configured with name %q", name)
+	}
+	opts := pc.Options()
+	if c.Credentials != nil {
+		store, err := c.Credentials.Build()
+		if err != nil {
+			return nil, fmt.Errorf("artifact publisher %q: %w", name, err)
+		}
+		if store != nil {
+			opts = append(opts, oras.WithPublisherCredentialStore(store))
+		}
+	}
+	return oras.NewPublisher(ctx, pc.RegistryURL, pc.FileStoreBasePath, opts...)
+}
+
+// Build translates this CredentialsConfig into a single oras.CredentialStore, chaining the static
+// credentials ahead of the Docker config.json ones (so an explicit override always wins).
+func (c *CredentialsConfig) Build() (oras.CredentialStore, error) {
+	var stores []oras.CredentialStore
+	if len(c.Static) > 0 {
+		entries := make(map[string]auth.Credential, len(c.Static))
+		for host, cred := range c.Static {
+			entries[host] = auth.Credential{
+				Username:     cred.Username,
+				Password:     cred.Password,
+				AccessToken:  cred.AccessToken,
+				RefreshToken: cred.RefreshToken,
+			}
+		}
+		stores = append(stores, oras.NewStaticCredentialStore(entries))
+	}
+	if c.DockerConfigPath != "" {
+		dockerStore, err := oras.NewDockerConfigCredentialStore(c.DockerConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("building docker config credential store: %w", err)
+		}
+		stores = append(stores, dockerStore)
+	}
+	if len(stores) == 0 {
+		return nil, nil
+	}
+	return oras.NewChainCredentialStore(stores...), nil
+}
+
+// ArtifactProvider builds the artifacts.Provider configured under name in c.ArtifactProviders, wiring in
+// c.Credentials as its CredentialStore when configured.
+func (c *Config) ArtifactProvider(ctx context.Context, name string) (artifacts.Provider, error) {
+	pc, ok := c.ArtifactProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("no artifact provider configured with name %q", name)
+	}
+	opts, err := pc.Options()
+	if err != nil {
+		return nil, fmt.Errorf("artifact provider %q: %w", name, err)
+	}
+	if c.Credentials != nil {
+		store, err := c.Credentials.Build()
+		if err != nil {
+			return nil, fmt.Errorf("artifact provider %q: %w", name, err)
+		}
+		if store != nil {
+			opts = append(opts, oras.WithCredentialStore(store))
+		}
+	}
+	return oras.Provider(ctx, pc.RegistryURL, pc.FileStoreBasePath, opts...)
+}
+
+// BuildPKI constructs the embedded PKI described by c.PKI. It returns nil, nil if PKI is not configured,
+// which callers should treat as "the embedded PKI is disabled" rather than an error.
+func (c *Config) BuildPKI() (*pki.PKI, error) {
+	if c.PKI == nil {
+		return nil, nil
+	}
+	return pki.New(*c.PKI)
+}
@@ -0,0 +1,25 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifacts
+
+// Media types for the staged artifacts that the seeder publishes and consumes. Declaring these explicitly
+// lets a consumer pick the right layer out of a manifest by media type, rather than by its position or by
+// falling back to a generic "is this an image layer" heuristic.
+const (
+	MediaTypeStage0Installer         = "application/vnd.hedgehog.stage0.v1+octet-stream"
+	MediaTypeStage1Installer         = "application/vnd.hedgehog.stage1.v1+octet-stream"
+	MediaTypeEmbeddedConfig          = "application/vnd.hedgehog.embedded-config.v1+json"
+	MediaTypeEmbeddedConfigSignature = "application/vnd.hedgehog.embedded-config-signature.v1+octet-stream"
+)
@@ -0,0 +1,267 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.githedgehog.com/dasboot/pkg/log"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// cacheMetaFileName is the name of the small sidecar file written into every cache entry's directory,
+// recording the cache key and layer descriptor it was populated for. dirForKey's sanitization of a cache key
+// into a directory name is lossy (both "/" and ":" collapse to different filler characters), so the key
+// cannot be recovered from the directory name alone; this sidecar is what lets newArtifactCache rebuild its
+// in-memory bookkeeping from whatever is already on disk after a restart.
+const cacheMetaFileName = ".cache-meta.json"
+
+// cacheMeta is the on-disk representation of a cacheEntry, minus lastAccess (which is tracked via the
+// sidecar file's own mtime instead, so that touching it on every access doesn't require rewriting the JSON).
+type cacheMeta struct {
+	Key       string        `json:"key"`
+	LayerDesc v1.Descriptor `json:"layer_desc"`
+	Size      int64         `json:"size"`
+}
+
+var (
+	cacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "dasboot",
+		Subsystem: "oras_provider",
+		Name:      "cache_hits_total",
+		Help:      "Number of artifact requests that were served from the on-disk cache.",
+	})
+	cacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "dasboot",
+		Subsystem: "oras_provider",
+		Name:      "cache_misses_total",
+		Help:      "Number of artifact requests that required a fetch from the registry.",
+	})
+	cacheBytesServed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "dasboot",
+		Subsystem: "oras_provider",
+		Name:      "cache_bytes_served_total",
+		Help:      "Total number of bytes served out of the on-disk cache.",
+	})
+)
+
+// cacheResult is what a cache lookup or a cache-populating fetch resolves to: the on-disk directory that
+// holds the OCI layout for the artifact, and the descriptor of the layer within it that should be served.
+type cacheResult struct {
+	dirPath   string
+	layerDesc v1.Descriptor
+}
+
+// cacheEntry tracks bookkeeping for a single cached artifact so it can be evicted again.
+type cacheEntry struct {
+	cacheResult
+	size       int64
+	lastAccess time.Time
+}
+
+// artifactCache is a persistent, content-addressable, concurrency-safe cache of artifacts that have been
+// pulled from a registry. Entries are keyed by "{repo}@{digest}" so that the same content is never pulled
+// twice, regardless of which tag was used to request it. Concurrent requests for the same key are coalesced
+// into a single fetch via singleflight.
+type artifactCache struct {
+	basePath string
+	maxSize  int64
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*cacheEntry
+	totalSize int64
+
+	sf singleflight.Group
+}
+
+// newArtifactCache creates a cache rooted at basePath. A maxSize of 0 means unbounded, and a ttl of 0 means
+// entries never expire on their own (they are still subject to LRU eviction once maxSize is exceeded). Any
+// entries already present under basePath/cache from a previous process lifetime are reloaded from their
+// sidecar metadata files, so size accounting and TTL/LRU eviction keep working across restarts.
+func newArtifactCache(basePath string, maxSize int64, ttl time.Duration) *artifactCache {
+	c := &artifactCache{
+		basePath: basePath,
+		maxSize:  maxSize,
+		ttl:      ttl,
+		entries:  make(map[string]*cacheEntry),
+	}
+	c.rebuildFromDisk()
+	return c
+}
+
+// rebuildFromDisk scans basePath/cache for entry directories left over from a previous process lifetime and
+// reconstructs c.entries and c.totalSize from their sidecar metadata files. Directories that have gone stale
+// (no sidecar, or an unparseable one, e.g. because populateCache was interrupted mid-write) are removed
+// rather than silently left to rot on disk forever.
+func (c *artifactCache) rebuildFromDisk() {
+	root := filepath.Join(c.basePath, "cache")
+	dirEntries, err := os.ReadDir(root)
+	if err != nil {
+		// most commonly: first run, nothing to restore yet
+		return
+	}
+
+	for _, de := range dirEntries {
+		if !de.IsDir() {
+			continue
+		}
+		dirPath := filepath.Join(root, de.Name())
+		metaPath := filepath.Join(dirPath, cacheMetaFileName)
+
+		b, err := os.ReadFile(metaPath)
+		if err != nil {
+			log.L().Warn("oras: removing cache directory with no metadata sidecar", zap.String("path", dirPath), zap.Error(err))
+			os.RemoveAll(dirPath)
+			continue
+		}
+		var meta cacheMeta
+		if err := json.Unmarshal(b, &meta); err != nil {
+			log.L().Warn("oras: removing cache directory with unparseable metadata sidecar", zap.String("path", dirPath), zap.Error(err))
+			os.RemoveAll(dirPath)
+			continue
+		}
+
+		lastAccess := time.Now()
+		if info, err := os.Stat(metaPath); err == nil {
+			lastAccess = info.ModTime()
+		}
+
+		c.entries[meta.Key] = &cacheEntry{
+			cacheResult: cacheResult{dirPath: dirPath, layerDesc: meta.LayerDesc},
+			size:        meta.Size,
+			lastAccess:  lastAccess,
+		}
+		c.totalSize += meta.Size
+	}
+
+	if len(c.entries) > 0 {
+		log.L().Info("oras: restored artifact cache entries from disk", zap.Int("count", len(c.entries)), zap.Int64("totalSize", c.totalSize))
+	}
+}
+
+// fetch returns the cached result for key if present and not expired, otherwise it calls populate to
+// retrieve it, stores the result, and evicts older entries if the cache has grown beyond maxSize. Concurrent
+// calls for the same key that miss the cache share a single call to populate.
+func (c *artifactCache) fetch(key string, populate func() (cacheResult, int64, error)) (cacheResult, error) {
+	if res, ok := c.lookup(key); ok {
+		cacheHits.Inc()
+		return res, nil
+	}
+	cacheMisses.Inc()
+
+	v, err, _ := c.sf.Do(key, func() (interface{}, error) {
+		// another goroutine might have populated the entry while we were waiting to be scheduled
+		if res, ok := c.lookup(key); ok {
+			return res, nil
+		}
+		res, size, err := populate()
+		if err != nil {
+			return cacheResult{}, err
+		}
+		c.put(key, res, size)
+		return res, nil
+	})
+	if err != nil {
+		return cacheResult{}, err
+	}
+	return v.(cacheResult), nil
+}
+
+func (c *artifactCache) lookup(key string) (cacheResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return cacheResult{}, false
+	}
+	if c.ttl > 0 && time.Since(e.lastAccess) > c.ttl {
+		delete(c.entries, key)
+		c.totalSize -= e.size
+		os.RemoveAll(e.dirPath)
+		return cacheResult{}, false
+	}
+	e.lastAccess = time.Now()
+	now := e.lastAccess
+	metaPath := filepath.Join(e.dirPath, cacheMetaFileName)
+	if err := os.Chtimes(metaPath, now, now); err != nil {
+		log.L().Debug("oras: touching cache metadata mtime failed", zap.String("path", metaPath), zap.Error(err))
+	}
+	return e.cacheResult, true
+}
+
+func (c *artifactCache) put(key string, res cacheResult, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &cacheEntry{
+		cacheResult: res,
+		size:        size,
+		lastAccess:  time.Now(),
+	}
+	c.totalSize += size
+
+	meta := cacheMeta{Key: key, LayerDesc: res.layerDesc, Size: size}
+	if b, err := json.Marshal(&meta); err != nil {
+		log.L().Warn("oras: marshaling cache metadata failed", zap.String("key", key), zap.Error(err))
+	} else if err := os.WriteFile(filepath.Join(res.dirPath, cacheMetaFileName), b, 0o644); err != nil {
+		log.L().Warn("oras: writing cache metadata failed", zap.String("key", key), zap.Error(err))
+	}
+
+	c.evictLocked(key)
+}
+
+// evictLocked removes the least recently used entries other than keep until the cache is within maxSize. The
+// entry for keep is never evicted, so an entry that alone exceeds maxSize stays cached. Callers must hold
+// c.mu.
+func (c *artifactCache) evictLocked(keep string) {
+	if c.maxSize <= 0 {
+		return
+	}
+	for c.totalSize > c.maxSize {
+		var oldestKey string
+		var oldest *cacheEntry
+		for k, e := range c.entries {
+			if k == keep {
+				continue
+			}
+			if oldest == nil || e.lastAccess.Before(oldest.lastAccess) {
+				oldestKey, oldest = k, e
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		log.L().Debug("oras: evicting cache entry", zap.String("key", oldestKey), zap.String("path", oldest.dirPath))
+		delete(c.entries, oldestKey)
+		c.totalSize -= oldest.size
+		os.RemoveAll(oldest.dirPath)
+	}
+}
+
+// dirForKey derives a deterministic, filesystem-safe directory name for a cache key of the form
+// "{repo}@{digest}", e.g. "nos/sonic@sha256:abcd..." becomes "nos_sonic@sha256-abcd...".
+func (c *artifactCache) dirForKey(key string) string {
+	sanitized := strings.NewReplacer("/", "_", ":", "-").Replace(key)
+	return filepath.Join(c.basePath, "cache", sanitized)
+}
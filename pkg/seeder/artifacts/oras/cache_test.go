@@ -0,0 +1,145 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func mkCacheDir(t *testing.T, c *artifactCache, key string) string {
+	t.Helper()
+	dir := c.dirForKey(key)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("creating cache dir: %v", err)
+	}
+	return dir
+}
+
+func TestArtifactCachePutLookup(t *testing.T) {
+	base := t.TempDir()
+	c := newArtifactCache(base, 0, 0)
+
+	dir := mkCacheDir(t, c, "repo@sha256:aaa")
+	res := cacheResult{dirPath: dir, layerDesc: v1.Descriptor{Digest: "sha256:aaa", Size: 10}}
+	c.put("repo@sha256:aaa", res, 10)
+
+	got, ok := c.lookup("repo@sha256:aaa")
+	if !ok {
+		t.Fatalf("lookup() = false, want true")
+	}
+	if got.dirPath != dir {
+		t.Errorf("lookup().dirPath = %q, want %q", got.dirPath, dir)
+	}
+	if c.totalSize != 10 {
+		t.Errorf("totalSize = %d, want 10", c.totalSize)
+	}
+
+	if _, ok := c.lookup("does-not-exist"); ok {
+		t.Errorf("lookup() for missing key = true, want false")
+	}
+}
+
+func TestArtifactCacheTTLExpiry(t *testing.T) {
+	base := t.TempDir()
+	c := newArtifactCache(base, 0, time.Millisecond)
+
+	dir := mkCacheDir(t, c, "repo@sha256:bbb")
+	c.put("repo@sha256:bbb", cacheResult{dirPath: dir, layerDesc: v1.Descriptor{Digest: "sha256:bbb", Size: 5}}, 5)
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := c.lookup("repo@sha256:bbb"); ok {
+		t.Errorf("lookup() after ttl expiry = true, want false")
+	}
+	if c.totalSize != 0 {
+		t.Errorf("totalSize after expiry = %d, want 0", c.totalSize)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expired cache directory %q still exists", dir)
+	}
+}
+
+func TestArtifactCacheEvictsLRU(t *testing.T) {
+	base := t.TempDir()
+	c := newArtifactCache(base, 15, 0)
+
+	dirA := mkCacheDir(t, c, "repo@sha256:a")
+	c.put("repo@sha256:a", cacheResult{dirPath: dirA, layerDesc: v1.Descriptor{Size: 10}}, 10)
+
+	// ensure A is older than B so it is the eviction candidate
+	time.Sleep(5 * time.Millisecond)
+
+	dirB := mkCacheDir(t, c, "repo@sha256:b")
+	c.put("repo@sha256:b", cacheResult{dirPath: dirB, layerDesc: v1.Descriptor{Size: 10}}, 10)
+
+	// total is now 20 > maxSize 15, so the least recently used entry (A) must have been evicted
+	if _, ok := c.lookup("repo@sha256:a"); ok {
+		t.Errorf("lookup(a) after eviction = true, want false")
+	}
+	if _, ok := c.lookup("repo@sha256:b"); !ok {
+		t.Errorf("lookup(b) after eviction = false, want true")
+	}
+	if c.totalSize != 10 {
+		t.Errorf("totalSize after eviction = %d, want 10", c.totalSize)
+	}
+	if _, err := os.Stat(dirA); !os.IsNotExist(err) {
+		t.Errorf("evicted cache directory %q still exists", dirA)
+	}
+}
+
+func TestArtifactCacheRebuildFromDisk(t *testing.T) {
+	base := t.TempDir()
+	c := newArtifactCache(base, 0, 0)
+
+	dir := mkCacheDir(t, c, "repo@sha256:ccc")
+	c.put("repo@sha256:ccc", cacheResult{dirPath: dir, layerDesc: v1.Descriptor{Digest: "sha256:ccc", Size: 7}}, 7)
+
+	// simulate a process restart: a fresh cache pointed at the same basePath must recover the entry that
+	// was already on disk, including its size accounting, without the original process's in-memory state.
+	restarted := newArtifactCache(base, 0, 0)
+
+	got, ok := restarted.lookup("repo@sha256:ccc")
+	if !ok {
+		t.Fatalf("lookup() after rebuild = false, want true")
+	}
+	if got.dirPath != dir {
+		t.Errorf("rebuilt dirPath = %q, want %q", got.dirPath, dir)
+	}
+	if restarted.totalSize != 7 {
+		t.Errorf("rebuilt totalSize = %d, want 7", restarted.totalSize)
+	}
+}
+
+func TestArtifactCacheRebuildRemovesOrphans(t *testing.T) {
+	base := t.TempDir()
+	orphan := filepath.Join(base, "cache", "orphan-no-metadata")
+	if err := os.MkdirAll(orphan, 0o755); err != nil {
+		t.Fatalf("creating orphan dir: %v", err)
+	}
+
+	c := newArtifactCache(base, 0, 0)
+
+	if len(c.entries) != 0 {
+		t.Errorf("entries after rebuild = %d, want 0", len(c.entries))
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphaned cache directory %q was not removed", orphan)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"go.githedgehog.com/dasboot/pkg/log"
+	"go.uber.org/zap"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// CredentialStore resolves registry credentials by host. Implementations may hold a username/password, a
+// static access or refresh token, or nothing at all (auth.EmptyCredential), in which case requests are made
+// anonymously. Once a Credential carries a RefreshToken or Username/Password, auth.Client itself takes care
+// of responding to a 401 "Www-Authenticate: Bearer ..." challenge by exchanging it for a short-lived,
+// correctly scoped access token and caching that until it is near expiry.
+type CredentialStore interface {
+	Credential(ctx context.Context, host string) (auth.Credential, error)
+}
+
+// staticCredentialStore serves a fixed set of credentials, keyed by registry host, which covers the common
+// case of a seeder talking to more than one registry (e.g. an upstream NOS registry and an internal staging
+// registry).
+type staticCredentialStore map[string]auth.Credential
+
+// NewStaticCredentialStore returns a CredentialStore backed by a fixed host -> credential mapping.
+func NewStaticCredentialStore(entries map[string]auth.Credential) CredentialStore {
+	return staticCredentialStore(entries)
+}
+
+// Credential implements CredentialStore.
+func (s staticCredentialStore) Credential(_ context.Context, host string) (auth.Credential, error) {
+	if cred, ok := s[host]; ok {
+		return cred, nil
+	}
+	return auth.EmptyCredential, nil
+}
+
+// dockerConfigCredentialStore reads credentials from a Docker-style config.json, the same format produced
+// by `docker login` and consumed by most container tooling. Besides the legacy inline "auth" field, it
+// understands "identitytoken" (used by several registries instead of a static password) and the
+// "credHelpers"/"credsStore" credential-helper protocol (the default on Docker Desktop, `aws ecr
+// get-login-password`, `gcloud auth configure-docker`, and most CI images), by invoking the configured
+// `docker-credential-<name>` helper binary the same way the Docker CLI does.
+type dockerConfigCredentialStore struct {
+	auths       map[string]dockerConfigAuth
+	credHelpers map[string]string
+	credsStore  string
+}
+
+type dockerConfigFile struct {
+	Auths       map[string]dockerConfigAuth `json:"auths"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+	CredsStore  string                      `json:"credsStore"`
+}
+
+type dockerConfigAuth struct {
+	Auth          string `json:"auth"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// NewDockerConfigCredentialStore loads a Docker config.json from path.
+func NewDockerConfigCredentialStore(path string) (CredentialStore, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading docker config: %w", err)
+	}
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing docker config: %w", err)
+	}
+	return &dockerConfigCredentialStore{
+		auths:       cfg.Auths,
+		credHelpers: cfg.CredHelpers,
+		credsStore:  cfg.CredsStore,
+	}, nil
+}
+
+// Credential implements CredentialStore.
+func (s *dockerConfigCredentialStore) Credential(ctx context.Context, host string) (auth.Credential, error) {
+	if helper, ok := s.credHelpers[host]; ok {
+		return s.credentialFromHelper(ctx, helper, host)
+	}
+
+	entry, ok := s.auths[host]
+	if !ok {
+		if s.credsStore != "" {
+			return s.credentialFromHelper(ctx, s.credsStore, host)
+		}
+		return auth.EmptyCredential, nil
+	}
+
+	if entry.IdentityToken != "" {
+		return auth.Credential{RefreshToken: entry.IdentityToken}, nil
+	}
+
+	if entry.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return auth.EmptyCredential, fmt.Errorf("decoding credentials for %q: %w", host, err)
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return auth.EmptyCredential, fmt.Errorf("malformed credentials for %q", host)
+		}
+		return auth.Credential{Username: username, Password: password}, nil
+	}
+
+	if s.credsStore != "" {
+		return s.credentialFromHelper(ctx, s.credsStore, host)
+	}
+
+	log.L().Warn("oras: docker config has an entry for host but no usable credential for it",
+		zap.String("host", host))
+	return auth.EmptyCredential, nil
+}
+
+// dockerCredentialHelperOutput is what a `docker-credential-<name> get` invocation prints on stdout, per
+// https://github.com/docker/docker-credential-helpers.
+type dockerCredentialHelperOutput struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// credentialFromHelper shells out to the docker-credential-<helper> binary to resolve host's credential, the
+// same protocol the Docker CLI itself uses. If the helper binary is missing or fails, this logs a warning and
+// falls through to an anonymous credential rather than failing the whole fetch.
+func (s *dockerConfigCredentialStore) credentialFromHelper(ctx context.Context, helper, host string) (auth.Credential, error) {
+	bin := "docker-credential-" + helper
+	cmd := exec.CommandContext(ctx, bin, "get")
+	cmd.Stdin = strings.NewReader(host)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		log.L().Warn("oras: docker credential helper failed, falling back to anonymous",
+			zap.String("helper", bin), zap.String("host", host), zap.Error(err))
+		return auth.EmptyCredential, nil
+	}
+
+	var out dockerCredentialHelperOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		log.L().Warn("oras: docker credential helper returned unparseable output, falling back to anonymous",
+			zap.String("helper", bin), zap.String("host", host), zap.Error(err))
+		return auth.EmptyCredential, nil
+	}
+
+	if out.Username == "<token>" {
+		return auth.Credential{RefreshToken: out.Secret}, nil
+	}
+	return auth.Credential{Username: out.Username, Password: out.Secret}, nil
+}
+
+// chainCredentialStore tries each CredentialStore in order and returns the first one that yields a non-empty
+// credential for the host.
+type chainCredentialStore []CredentialStore
+
+// NewChainCredentialStore returns a CredentialStore that tries each of stores in order, falling through to
+// the next on an empty (but not erroring) result.
+func NewChainCredentialStore(stores ...CredentialStore) CredentialStore {
+	return chainCredentialStore(stores)
+}
+
+// Credential implements CredentialStore.
+func (c chainCredentialStore) Credential(ctx context.Context, host string) (auth.Credential, error) {
+	for _, store := range c {
+		cred, err := store.Credential(ctx, host)
+		if err != nil {
+			return auth.EmptyCredential, err
+		}
+		if cred != auth.EmptyCredential {
+			return cred, nil
+		}
+	}
+	return auth.EmptyCredential, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+func writeDockerConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing docker config: %v", err)
+	}
+	return path
+}
+
+func TestDockerConfigCredentialStoreBasicAuth(t *testing.T) {
+	basicAuth := base64.StdEncoding.EncodeToString([]byte("alice:hunter2"))
+	path := writeDockerConfig(t, `{"auths":{"registry.example.com":{"auth":"`+basicAuth+`"}}}`)
+
+	store, err := NewDockerConfigCredentialStore(path)
+	if err != nil {
+		t.Fatalf("NewDockerConfigCredentialStore: %v", err)
+	}
+
+	cred, err := store.Credential(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Credential: %v", err)
+	}
+	want := auth.Credential{Username: "alice", Password: "hunter2"}
+	if cred != want {
+		t.Errorf("Credential() = %+v, want %+v", cred, want)
+	}
+}
+
+func TestDockerConfigCredentialStoreIdentityToken(t *testing.T) {
+	path := writeDockerConfig(t, `{"auths":{"registry.example.com":{"auth":"","identitytoken":"tok-123"}}}`)
+
+	store, err := NewDockerConfigCredentialStore(path)
+	if err != nil {
+		t.Fatalf("NewDockerConfigCredentialStore: %v", err)
+	}
+
+	cred, err := store.Credential(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Credential: %v", err)
+	}
+	want := auth.Credential{RefreshToken: "tok-123"}
+	if cred != want {
+		t.Errorf("Credential() = %+v, want %+v", cred, want)
+	}
+}
+
+func TestDockerConfigCredentialStoreUnknownHost(t *testing.T) {
+	path := writeDockerConfig(t, `{"auths":{}}`)
+
+	store, err := NewDockerConfigCredentialStore(path)
+	if err != nil {
+		t.Fatalf("NewDockerConfigCredentialStore: %v", err)
+	}
+
+	cred, err := store.Credential(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Credential: %v", err)
+	}
+	if cred != auth.EmptyCredential {
+		t.Errorf("Credential() for unknown host = %+v, want EmptyCredential", cred)
+	}
+}
+
+func TestDockerConfigCredentialStoreCredHelperMissingBinary(t *testing.T) {
+	path := writeDockerConfig(t, `{"credHelpers":{"registry.example.com":"does-not-exist-anywhere"}}`)
+
+	store, err := NewDockerConfigCredentialStore(path)
+	if err != nil {
+		t.Fatalf("NewDockerConfigCredentialStore: %v", err)
+	}
+
+	// the helper binary does not exist; Credential must fall through to an anonymous credential rather
+	// than returning an error, so that one misconfigured host doesn't take down every other fetch.
+	cred, err := store.Credential(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Credential: %v", err)
+	}
+	if cred != auth.EmptyCredential {
+		t.Errorf("Credential() with missing helper binary = %+v, want EmptyCredential", cred)
+	}
+}
+
+func TestChainCredentialStoreFallsThrough(t *testing.T) {
+	empty := NewStaticCredentialStore(map[string]auth.Credential{})
+	real := NewStaticCredentialStore(map[string]auth.Credential{
+		"registry.example.com": {Username: "bob", Password: "secret"},
+	})
+	chain := NewChainCredentialStore(empty, real)
+
+	cred, err := chain.Credential(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Credential: %v", err)
+	}
+	want := auth.Credential{Username: "bob", Password: "secret"}
+	if cred != want {
+		t.Errorf("Credential() = %+v, want %+v", cred, want)
+	}
+}
+
+func TestChainCredentialStoreAllEmpty(t *testing.T) {
+	chain := NewChainCredentialStore(
+		NewStaticCredentialStore(map[string]auth.Credential{}),
+		NewStaticCredentialStore(map[string]auth.Credential{}),
+	)
+
+	cred, err := chain.Credential(context.Background(), "registry.example.com")
+	if err != nil {
+		t.Fatalf("Credential: %v", err)
+	}
+	if cred != auth.EmptyCredential {
+		t.Errorf("Credential() = %+v, want EmptyCredential", cred)
+	}
+}
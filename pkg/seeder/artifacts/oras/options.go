@@ -0,0 +1,197 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ProviderOption configures an orasProvider at construction time through Provider(). An option that cannot
+// be applied (e.g. WithVerificationKeys given a path that doesn't load) returns an error, which Provider()
+// surfaces as a construction failure rather than silently applying a weaker configuration than requested.
+type ProviderOption func(*orasProvider) error
+
+// WithServerCA configures a custom CA bundle that is used to validate the
+// registry's TLS server certificate instead of the system trust store. This
+// is typically needed when talking to a private, on-prem registry.
+func WithServerCA(caPath string) ProviderOption {
+	return func(op *orasProvider) error {
+		op.serverCAPath = caPath
+		return nil
+	}
+}
+
+// WithClientCertificate configures a client certificate and key that are
+// presented to the registry, enabling mutual TLS.
+func WithClientCertificate(certPath, keyPath string) ProviderOption {
+	return func(op *orasProvider) error {
+		op.clientCertPath = certPath
+		op.clientKeyPath = keyPath
+		return nil
+	}
+}
+
+// WithCredentials configures a static username/password pair which is used
+// for basic auth against the registry.
+func WithCredentials(username, password string) ProviderOption {
+	return func(op *orasProvider) error {
+		op.username = username
+		op.password = password
+		return nil
+	}
+}
+
+// WithAccessToken configures a static bearer access token which is used for
+// auth against the registry.
+func WithAccessToken(accessToken string) ProviderOption {
+	return func(op *orasProvider) error {
+		op.accessToken = accessToken
+		return nil
+	}
+}
+
+// WithRefreshToken configures a static OAuth2 refresh token which is used to
+// obtain access tokens for auth against the registry.
+func WithRefreshToken(refreshToken string) ProviderOption {
+	return func(op *orasProvider) error {
+		op.refreshToken = refreshToken
+		return nil
+	}
+}
+
+// WithPlainHTTP disables TLS entirely and talks plain HTTP to the registry.
+// This is only meant for on-prem or test registries that are not exposed
+// beyond a trusted network.
+func WithPlainHTTP() ProviderOption {
+	return func(op *orasProvider) error {
+		op.plainHTTP = true
+		return nil
+	}
+}
+
+// WithInsecureSkipVerify disables verification of the registry's TLS server
+// certificate. This must only ever be used for testing, as it defeats the
+// purpose of TLS altogether.
+func WithInsecureSkipVerify() ProviderOption {
+	return func(op *orasProvider) error {
+		op.insecureSkipVerify = true
+		return nil
+	}
+}
+
+// WithArtifactPins configures expected manifest digests per artifact name.
+// When an artifact is requested, and a pin is registered for it under the
+// name that was used to address it (ignoring any tag or digest suffix), Get
+// will fail closed if the digest that was actually resolved from the
+// registry does not match the pin.
+func WithArtifactPins(pins map[string]string) ProviderOption {
+	return func(op *orasProvider) error {
+		op.artifactPins = pins
+		return nil
+	}
+}
+
+// WithVerificationKeys configures a set of trusted cosign/sigstore public keys (PEM encoded ECDSA P-256
+// keys, one file each). When configured, Get will look for a cosign signature tag alongside the requested
+// artifact and refuse to serve it unless at least one signature verifies against one of these keys. A key
+// path that fails to load is a construction error: this is the provider's supply-chain enforcement, so a
+// typo in the configured path must refuse to start rather than silently disable signature verification.
+func WithVerificationKeys(keyPaths ...string) ProviderOption {
+	return func(op *orasProvider) error {
+		for _, keyPath := range keyPaths {
+			key, err := loadECDSAPublicKey(keyPath)
+			if err != nil {
+				return fmt.Errorf("loading verification key %q: %w", keyPath, err)
+			}
+			op.verificationKeys = append(op.verificationKeys, key)
+		}
+		return nil
+	}
+}
+
+// WithCredentialStore configures a CredentialStore that resolves credentials per registry host, taking
+// precedence over WithCredentials/WithAccessToken/WithRefreshToken. Use this when the provider needs to
+// authenticate against more than one host, or when credentials should come from a Docker config.json.
+func WithCredentialStore(store CredentialStore) ProviderOption {
+	return func(op *orasProvider) error {
+		op.credentialStore = store
+		return nil
+	}
+}
+
+// WithArtifactMediaTypes configures, per artifact name, the media type that Get should use to pick the
+// right layer out of a multi-artifact manifest. When not set for an artifact, Get falls back to its
+// positional heuristic.
+func WithArtifactMediaTypes(mediaTypes map[string]string) ProviderOption {
+	return func(op *orasProvider) error {
+		op.artifactMediaTypes = mediaTypes
+		return nil
+	}
+}
+
+// WithCacheSize sets the maximum total size in bytes that the on-disk artifact cache is allowed to grow to.
+// Once exceeded, the least recently used entries are evicted. A size of 0 (the default) means unbounded.
+func WithCacheSize(maxBytes int64) ProviderOption {
+	return func(op *orasProvider) error {
+		op.cacheMaxSize = maxBytes
+		return nil
+	}
+}
+
+// WithCacheTTL sets how long a cached artifact may go unused before it is considered stale and re-fetched
+// from the registry. A ttl of 0 (the default) means cached entries never expire on their own.
+func WithCacheTTL(ttl time.Duration) ProviderOption {
+	return func(op *orasProvider) error {
+		op.cacheTTL = ttl
+		return nil
+	}
+}
+
+// caPool builds a certificate pool from the given CA bundle path. If caPath is empty, a nil pool is returned
+// which makes the TLS stack fall back to the system trust store. An operator who configured ServerCAPath is
+// trusting it to be enforced, so a bundle that cannot be read or contains no certificates is a construction
+// error rather than a silent fallback to the system trust store.
+func caPool(caPath string) (*x509.CertPool, error) {
+	if caPath == "" {
+		return nil, nil
+	}
+	pemBytes, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle %q: %w", caPath, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %q", caPath)
+	}
+	return pool, nil
+}
+
+// clientCertificates loads a client certificate/key pair for mTLS. If either path is empty, no client
+// certificate is configured. A configured pair that fails to load is a construction error rather than a
+// silent downgrade to anonymous TLS.
+func clientCertificates(certPath, keyPath string) ([]tls.Certificate, error) {
+	if certPath == "" || keyPath == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate %q/%q: %w", certPath, keyPath, err)
+	}
+	return []tls.Certificate{cert}, nil
+}
@@ -16,12 +16,9 @@ package oras
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/tls"
+	"crypto/ecdsa"
 	"fmt"
 	"io"
-	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"path"
@@ -36,116 +33,68 @@ import (
 	"oras.land/oras-go/v2/content"
 	"oras.land/oras-go/v2/content/file"
 	"oras.land/oras-go/v2/registry/remote"
-	"oras.land/oras-go/v2/registry/remote/auth"
 )
 
 type orasProvider struct {
 	ctx context.Context
 
-	serverCAPath      string
-	clientCertPath    string
-	clientKeyPath     string
-	username          string
-	password          string
-	accessToken       string
-	refreshToken      string
-	fileStoreBasePath string
+	serverCAPath       string
+	clientCertPath     string
+	clientKeyPath      string
+	username           string
+	password           string
+	accessToken        string
+	refreshToken       string
+	fileStoreBasePath  string
+	plainHTTP          bool
+	insecureSkipVerify bool
+	credentialStore    CredentialStore
+	artifactPins       map[string]string
+	artifactMediaTypes map[string]string
+	verificationKeys   []*ecdsa.PublicKey
+	cacheMaxSize       int64
+	cacheTTL           time.Duration
 
 	url      *url.URL
 	registry *remote.Registry
+	cache    *artifactCache
 }
 
 var _ artifacts.Provider = &orasProvider{}
 
 func Provider(ctx context.Context, registryURL, fileStoreBasePath string, options ...ProviderOption) (artifacts.Provider, error) {
-	var err error
 	// apply options
 	ret := &orasProvider{
 		ctx:               ctx,
 		fileStoreBasePath: fileStoreBasePath,
 	}
 	for _, opt := range options {
-		opt(ret)
+		if err := opt(ret); err != nil {
+			return nil, fmt.Errorf("applying provider option: %w", err)
+		}
 	}
+	ret.cache = newArtifactCache(fileStoreBasePath, ret.cacheMaxSize, ret.cacheTTL)
 
 	// create file store
 	if fileStoreBasePath == "" {
 		return nil, fmt.Errorf("fileStoreBasePath must not be empty")
 	}
 
-	// parse URL
-	ret.url, err = url.Parse(registryURL)
-	if err != nil {
-		return nil, fmt.Errorf("parsing registry URL: %w", err)
-	}
-	if ret.url.Scheme != "oci" {
-		return nil, fmt.Errorf("registry URL must have OCI scheme, got '%s'", ret.url.Scheme)
-	}
-
-	ret.registry, err = remote.NewRegistry(ret.url.Host)
+	var err error
+	ret.registry, ret.url, err = newRegistry(registryURL, registryConnection{
+		serverCAPath:       ret.serverCAPath,
+		clientCertPath:     ret.clientCertPath,
+		clientKeyPath:      ret.clientKeyPath,
+		username:           ret.username,
+		password:           ret.password,
+		accessToken:        ret.accessToken,
+		refreshToken:       ret.refreshToken,
+		plainHTTP:          ret.plainHTTP,
+		insecureSkipVerify: ret.insecureSkipVerify,
+		credentialStore:    ret.credentialStore,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("create ORAS client: %w", err)
-	}
-
-	creds := func(_ context.Context, target string) (auth.Credential, error) {
-		if ret.username != "" || ret.password != "" || ret.accessToken != "" || ret.refreshToken != "" {
-			if target == ret.url.Host {
-				return auth.Credential{
-					Username:     ret.username,
-					Password:     ret.password,
-					AccessToken:  ret.accessToken,
-					RefreshToken: ret.refreshToken,
-				}, nil
-			}
-		}
-		return auth.EmptyCredential, nil
-	}
-
-	ret.registry.Client = &auth.Client{
-		Credential: creds,
-		Cache:      auth.NewCache(),
-		Client: &http.Client{
-			Transport: &http.Transport{
-				// take proxy from the environment if set
-				Proxy: http.ProxyFromEnvironment,
-
-				// There are no connection timeouts
-				// so we are doing pretty much exactly what
-				// Go is doing itself
-				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-					// increasing this from the default Go settings
-					// as we can ensure that if there is IPv6 in our network
-					// it actually *must* be configured correctly.
-					FallbackDelay: 600 * time.Millisecond,
-				}).DialContext,
-
-				// These are HTTP keep alives (not TCP keepalives)
-				// and their corresponding idle connection settings and timeouts
-				DisableKeepAlives: false,
-				MaxIdleConns:      10,
-				MaxConnsPerHost:   3,
-				IdleConnTimeout:   90 * time.Second,
-
-				TLSHandshakeTimeout:   10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-
-				// as we are setting our own DialContext and TLSClientConfig
-				// Go internally disables trying to use HTTP/2 (why?)
-				// so we are reenabling this here
-				ForceAttemptHTTP2: true,
-
-				// Our TLS configuration that we prepped before
-				TLSClientConfig: &tls.Config{
-					Rand:         rand.Reader,
-					Time:         time.Now,
-					RootCAs:      caPool(ret.serverCAPath),
-					Certificates: clientCertificates(ret.clientCertPath, ret.clientKeyPath),
-					MinVersion:   tls.VersionTLS12,
-				},
-			},
-		},
+		return nil, err
 	}
 
 	return ret, nil
@@ -156,98 +105,141 @@ func (op *orasProvider) Get(artifact string) (rc io.ReadCloser) {
 	ctx, cancel := context.WithTimeout(op.ctx, time.Second*60)
 	defer cancel()
 
+	// parse the artifact reference into its name and the ref (tag or digest)
+	// that should actually be resolved against the registry
+	artifactName, tagName, pinnedDigest, err := parseArtifactReference(artifact)
+	if err != nil {
+		log.L().Error("oras: parsing artifact reference failed", zap.String("artifact", artifact), zap.Error(err))
+		return nil
+	}
+
 	// build repo name from artifact
 	// we need to remove the left most '/' as it would render an invalid repository name
-	repoName := path.Join(op.url.Path, artifact)
+	repoName := path.Join(op.url.Path, artifactName)
 	repoName = strings.TrimLeft(repoName, "/")
-	src, err := op.registry.Repository(ctx, repoName)
-	if err != nil {
-		log.L().Error("oras: getting repository reference failed", zap.String("repo", repoName), zap.Error(err))
+
+	// establish the digest that keys the cache, either because the caller pinned one explicitly, or by
+	// resolving the requested tag against the registry
+	resolvedDigest := pinnedDigest
+	if resolvedDigest == "" {
+		src, err := op.registry.Repository(ctx, repoName)
+		if err != nil {
+			log.L().Error("oras: getting repository reference failed", zap.String("repo", repoName), zap.Error(err))
+			return nil
+		}
+		desc, err := src.Resolve(ctx, tagName)
+		if err != nil {
+			log.L().Error("oras: resolving tag failed", zap.String("repo", repoName), zap.String("tag", tagName), zap.Error(err))
+			return nil
+		}
+		resolvedDigest = desc.Digest
+	}
+	// a configured pin is checked here as well as in populateCache, so that a cached entry (e.g. one
+	// restored from disk) is never served for a digest that does not match the pin
+	if pin, ok := op.artifactPins[artifactName]; ok && resolvedDigest.String() != pin {
+		log.L().Error("oras: resolved digest does not match configured pin", zap.String("repo", repoName), zap.String("digest", resolvedDigest.String()), zap.String("pin", pin))
 		return nil
 	}
+	cacheKey := repoName + "@" + resolvedDigest.String()
 
-	// TODO: tag name
-	tagName := "latest"
+	res, err := op.cache.fetch(cacheKey, func() (cacheResult, int64, error) {
+		return op.populateCache(ctx, repoName, artifactName, tagName, cacheKey)
+	})
+	if err != nil {
+		log.L().Error("oras: fetching artifact failed", zap.String("repo", repoName), zap.String("cacheKey", cacheKey), zap.Error(err))
+		return nil
+	}
 
-	// downloads the stuff locally
-	fileStorePath, err := os.MkdirTemp(op.fileStoreBasePath, "oras-provider-file-store-*")
+	fileStore, err := file.New(res.dirPath)
 	if err != nil {
-		log.L().Error("oras: failed to create temporary directory for file store", zap.String("repo", repoName), zap.Error(err))
+		log.L().Error("oras: failed to open cached file store", zap.String("path", res.dirPath), zap.Error(err))
 		return nil
 	}
-	defer func() {
-		if rc == nil {
-			log.L().Debug("oras: cleaning up temporary file store path", zap.String("fileStorePath", fileStorePath))
-			os.RemoveAll(fileStorePath)
-		}
-	}()
-	fileStore, err := file.New(fileStorePath)
+	blob, err := fileStore.Fetch(ctx, res.layerDesc)
 	if err != nil {
-		log.L().Error("oras: failed to create file store", zap.String("repo", repoName), zap.Error(err))
+		log.L().Error("oras: fetch layer content failed", zap.String("repo", repoName), zap.Error(err))
 		return nil
 	}
+	cacheBytesServed.Add(float64(res.layerDesc.Size))
+	return blob
+}
 
-	rootDesc, err := oras.Copy(ctx, src, tagName, fileStore, tagName, oras.DefaultCopyOptions)
+// populateCache pulls artifactName (addressed via tagName) from the registry into its persistent cache
+// directory, verifying any configured pin and signature, and returns the descriptor of the layer that
+// should be served for it. On any failure, the partially populated cache directory is removed.
+func (op *orasProvider) populateCache(ctx context.Context, repoName, artifactName, tagName, cacheKey string) (cacheResult, int64, error) {
+	src, err := op.registry.Repository(ctx, repoName)
 	if err != nil {
-		log.L().Error("oras: copying artifact into memory failed", zap.String("repo", repoName), zap.Error(err))
-		return nil
+		return cacheResult{}, 0, fmt.Errorf("getting repository reference: %w", err)
 	}
 
-	// fetch all entries for the tag
-	nodes, err := content.Successors(ctx, fileStore, rootDesc)
+	dirPath := op.cache.dirForKey(cacheKey)
+	if err := os.MkdirAll(dirPath, 0o755); err != nil {
+		return cacheResult{}, 0, fmt.Errorf("creating cache directory: %w", err)
+	}
+	fileStore, err := file.New(dirPath)
 	if err != nil {
-		log.L().Error("oras: fetching successors failed", zap.String("repo", repoName), zap.Error(err))
-		return nil
+		os.RemoveAll(dirPath)
+		return cacheResult{}, 0, fmt.Errorf("creating file store: %w", err)
 	}
 
-	if len(nodes) == 1 {
-		// we would expect just one layer usually, which means we'll just download that
-		// and we'll assume this is the content that we are looking for
-		ret, err := fileStore.Fetch(ctx, nodes[0])
-		if err != nil {
-			log.L().Error("oras: fetch layer content failed", zap.String("repo", repoName), zap.Error(err))
-			return nil
-		}
-		return ret
-	} else {
-		// otherwise we are looking through all the nodes and look for the first "normal" image layer entry
-		for _, node := range nodes {
-			if node.MediaType == v1.MediaTypeImageLayer {
-				// this is probably the right media type for now
-				ret, err := fileStore.Fetch(ctx, node)
-				if err != nil {
-					log.L().Error("oras: fetch layer content failed", zap.String("repo", repoName), zap.Error(err))
-					return nil
-				}
-				return &orasReadCloser{
-					fileStorePath: fileStorePath,
-					rc:            ret,
-				}
-			}
+	rootDesc, err := oras.Copy(ctx, src, tagName, fileStore, tagName, oras.DefaultCopyOptions)
+	if err != nil {
+		os.RemoveAll(dirPath)
+		return cacheResult{}, 0, fmt.Errorf("copying artifact: %w", err)
+	}
+
+	// an artifact pin, if configured for this artifact, must match the manifest digest that was actually
+	// resolved, or we fail closed rather than serving content that does not match what the operator expects
+	if pin, ok := op.artifactPins[artifactName]; ok && rootDesc.Digest.String() != pin {
+		os.RemoveAll(dirPath)
+		return cacheResult{}, 0, fmt.Errorf("resolved digest %s does not match configured pin %s", rootDesc.Digest, pin)
+	}
+
+	// refuse to serve artifacts that are not signed by one of the trusted verification keys
+	if len(op.verificationKeys) > 0 {
+		if err := verifySignature(ctx, src, rootDesc.Digest, op.verificationKeys, op.fileStoreBasePath); err != nil {
+			os.RemoveAll(dirPath)
+			return cacheResult{}, 0, fmt.Errorf("verifying signature: %w", err)
 		}
 	}
 
-	// artifact not found
-	log.L().Error("oras: no image layers in artifact", zap.String("repo", repoName))
-	return nil
-}
+	nodes, err := content.Successors(ctx, fileStore, rootDesc)
+	if err != nil {
+		os.RemoveAll(dirPath)
+		return cacheResult{}, 0, fmt.Errorf("fetching successors: %w", err)
+	}
 
-type orasReadCloser struct {
-	fileStorePath string
-	rc            io.ReadCloser
-}
+	layerDesc, err := selectLayer(nodes, op.artifactMediaTypes[artifactName])
+	if err != nil {
+		os.RemoveAll(dirPath)
+		return cacheResult{}, 0, err
+	}
 
-// Close implements io.ReadCloser.
-func (orc *orasReadCloser) Close() error {
-	err := orc.rc.Close()
-	log.L().Debug("oras: ReadCloser: cleaning up temporary file store path on Close", zap.String("fileStorePath", orc.fileStorePath))
-	os.RemoveAll(orc.fileStorePath)
-	return err
+	return cacheResult{dirPath: dirPath, layerDesc: layerDesc}, layerDesc.Size, nil
 }
 
-// Read implements io.ReadCloser.
-func (orc *orasReadCloser) Read(p []byte) (n int, err error) {
-	return orc.rc.Read(p)
+// selectLayer picks the layer to serve out of an artifact's successor nodes. If wantMediaType is set, the
+// first node that declares that exact media type is used, which lets multi-artifact manifests (e.g. an
+// installer binary alongside its embedded config) be told apart reliably. Otherwise, it falls back to the
+// old heuristic: if there is exactly one node it is assumed to be the content we are looking for, and
+// failing that, the first "normal" image layer entry is used.
+func selectLayer(nodes []v1.Descriptor, wantMediaType string) (v1.Descriptor, error) {
+	if wantMediaType != "" {
+		for _, node := range nodes {
+			if node.MediaType == wantMediaType {
+				return node, nil
+			}
+		}
+		return v1.Descriptor{}, fmt.Errorf("no layer with media type %q in artifact", wantMediaType)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	for _, node := range nodes {
+		if node.MediaType == v1.MediaTypeImageLayer {
+			return node, nil
+		}
+	}
+	return v1.Descriptor{}, fmt.Errorf("no image layers in artifact")
 }
-
-var _ io.ReadCloser = &orasReadCloser{}
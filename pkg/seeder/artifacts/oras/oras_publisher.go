@@ -0,0 +1,190 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.githedgehog.com/dasboot/pkg/log"
+	"go.githedgehog.com/dasboot/pkg/seeder/artifacts"
+	"go.uber.org/zap"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/file"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+// orasPublisher is the inverse of orasProvider: it pushes staged artifacts (e.g. an installer binary, its
+// generated embedded config, and a signature over both) into an OCI registry, keyed by switch identity.
+type orasPublisher struct {
+	ctx context.Context
+
+	registryConnection
+	fileStoreBasePath string
+
+	url      *url.URL
+	registry *remote.Registry
+}
+
+var _ artifacts.Publisher = &orasPublisher{}
+
+// PublisherOption configures an orasPublisher at construction time through NewPublisher().
+type PublisherOption func(*orasPublisher)
+
+// WithPublisherServerCA is the Publisher counterpart of WithServerCA.
+func WithPublisherServerCA(caPath string) PublisherOption {
+	return func(op *orasPublisher) { op.serverCAPath = caPath }
+}
+
+// WithPublisherClientCertificate is the Publisher counterpart of WithClientCertificate.
+func WithPublisherClientCertificate(certPath, keyPath string) PublisherOption {
+	return func(op *orasPublisher) {
+		op.clientCertPath = certPath
+		op.clientKeyPath = keyPath
+	}
+}
+
+// WithPublisherCredentials is the Publisher counterpart of WithCredentials.
+func WithPublisherCredentials(username, password string) PublisherOption {
+	return func(op *orasPublisher) {
+		op.username = username
+		op.password = password
+	}
+}
+
+// WithPublisherPlainHTTP is the Publisher counterpart of WithPlainHTTP.
+func WithPublisherPlainHTTP() PublisherOption {
+	return func(op *orasPublisher) { op.plainHTTP = true }
+}
+
+// WithPublisherInsecureSkipVerify is the Publisher counterpart of WithInsecureSkipVerify.
+func WithPublisherInsecureSkipVerify() PublisherOption {
+	return func(op *orasPublisher) { op.insecureSkipVerify = true }
+}
+
+// WithPublisherCredentialStore is the Publisher counterpart of WithCredentialStore.
+func WithPublisherCredentialStore(store CredentialStore) PublisherOption {
+	return func(op *orasPublisher) { op.credentialStore = store }
+}
+
+// NewPublisher creates an artifacts.Publisher that pushes artifacts as OCI artifacts into the registry at
+// registryURL (which must use the "oci" scheme), staging them locally under fileStoreBasePath before push.
+func NewPublisher(ctx context.Context, registryURL, fileStoreBasePath string, options ...PublisherOption) (artifacts.Publisher, error) {
+	if fileStoreBasePath == "" {
+		return nil, fmt.Errorf("fileStoreBasePath must not be empty")
+	}
+
+	ret := &orasPublisher{
+		ctx:               ctx,
+		fileStoreBasePath: fileStoreBasePath,
+	}
+	for _, opt := range options {
+		opt(ret)
+	}
+
+	var err error
+	ret.registry, ret.url, err = newRegistry(registryURL, ret.registryConnection)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Publish implements artifacts.Publisher
+func (op *orasPublisher) Publish(identity string, layers ...artifacts.PublishLayer) (string, error) {
+	ctx, cancel := context.WithTimeout(op.ctx, time.Second*60)
+	defer cancel()
+
+	repoName := path.Join(op.url.Path, identity)
+	repoName = strings.TrimLeft(repoName, "/")
+	dst, err := op.registry.Repository(ctx, repoName)
+	if err != nil {
+		return "", fmt.Errorf("getting repository reference: %w", err)
+	}
+
+	digest, err := stageAndPush(ctx, dst, op.fileStoreBasePath, identity, layers)
+	if err != nil {
+		return "", err
+	}
+
+	log.L().Info("oras: published artifact", zap.String("repo", repoName), zap.String("digest", digest))
+	return digest, nil
+}
+
+// stageAndPush writes layers out to a local file store, packs them into a manifest tagged as identity, and
+// copies the result into dst. It is split out from Publish so that it can be exercised against an in-memory
+// oras.Target in tests, without needing a real registry to push to.
+func stageAndPush(ctx context.Context, dst oras.Target, fileStoreBasePath, identity string, layers []artifacts.PublishLayer) (string, error) {
+	if len(layers) == 0 {
+		return "", fmt.Errorf("at least one layer must be provided")
+	}
+
+	stagingPath, err := os.MkdirTemp(fileStoreBasePath, "oras-publisher-staging-*")
+	if err != nil {
+		return "", fmt.Errorf("creating staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingPath)
+	fileStore, err := file.New(stagingPath)
+	if err != nil {
+		return "", fmt.Errorf("creating file store: %w", err)
+	}
+
+	descriptors := make([]v1.Descriptor, 0, len(layers))
+	for i, layer := range layers {
+		name := fmt.Sprintf("layer-%d", i)
+		blobPath := path.Join(stagingPath, name)
+		f, err := os.Create(blobPath)
+		if err != nil {
+			return "", fmt.Errorf("staging layer %d: %w", i, err)
+		}
+		if _, err := io.Copy(f, layer.Content); err != nil {
+			f.Close()
+			return "", fmt.Errorf("staging layer %d: %w", i, err)
+		}
+		f.Close()
+
+		desc, err := fileStore.Add(ctx, name, layer.MediaType, blobPath)
+		if err != nil {
+			return "", fmt.Errorf("adding layer %d to file store: %w", i, err)
+		}
+		descriptors = append(descriptors, desc)
+	}
+
+	manifestDesc, err := oras.PackManifest(ctx, fileStore, oras.PackManifestVersion1_1, "application/vnd.hedgehog.seeder.artifact.v1", oras.PackManifestOptions{
+		Layers: descriptors,
+	})
+	if err != nil {
+		return "", fmt.Errorf("packing manifest: %w", err)
+	}
+
+	tag := identity
+	if err := fileStore.Tag(ctx, manifestDesc, tag); err != nil {
+		return "", fmt.Errorf("tagging manifest: %w", err)
+	}
+
+	if _, err := oras.Copy(ctx, fileStore, tag, dst, tag, oras.DefaultCopyOptions); err != nil {
+		return "", fmt.Errorf("pushing artifact: %w", err)
+	}
+
+	return manifestDesc.Digest.String(), nil
+}
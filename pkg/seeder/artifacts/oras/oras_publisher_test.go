@@ -0,0 +1,114 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"testing"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.githedgehog.com/dasboot/pkg/seeder/artifacts"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/memory"
+)
+
+func TestStageAndPushRejectsNoLayers(t *testing.T) {
+	_, err := stageAndPush(context.Background(), memory.New(), t.TempDir(), "switch-serial-123", nil)
+	if err == nil {
+		t.Fatal("stageAndPush(no layers) = nil error, want one")
+	}
+}
+
+func TestStageAndPushRoundTripsLayersAndTag(t *testing.T) {
+	ctx := context.Background()
+	dst := memory.New()
+
+	wantContents := map[string][]byte{
+		"application/vnd.hedgehog.seeder.installer.v1": []byte("installer-binary"),
+		"application/vnd.hedgehog.seeder.config.v1":    []byte("embedded-config"),
+	}
+	layers := []artifacts.PublishLayer{
+		{MediaType: "application/vnd.hedgehog.seeder.installer.v1", Content: bytes.NewReader(wantContents["application/vnd.hedgehog.seeder.installer.v1"])},
+		{MediaType: "application/vnd.hedgehog.seeder.config.v1", Content: bytes.NewReader(wantContents["application/vnd.hedgehog.seeder.config.v1"])},
+	}
+
+	digest, err := stageAndPush(ctx, dst, t.TempDir(), "switch-serial-123", layers)
+	if err != nil {
+		t.Fatalf("stageAndPush: %v", err)
+	}
+	if digest == "" {
+		t.Fatal("stageAndPush returned an empty digest")
+	}
+
+	manifestDesc, err := dst.Resolve(ctx, "switch-serial-123")
+	if err != nil {
+		t.Fatalf("resolving tag: %v", err)
+	}
+	if manifestDesc.Digest.String() != digest {
+		t.Errorf("tagged manifest digest = %q, want %q", manifestDesc.Digest, digest)
+	}
+
+	successors, err := content.Successors(ctx, dst, manifestDesc)
+	if err != nil {
+		t.Fatalf("fetching manifest successors: %v", err)
+	}
+	// Successors also returns the manifest's (empty, auto-generated) config blob alongside the layers we
+	// actually staged, since PackManifest was not given an explicit one.
+	var layerDescs []v1.Descriptor
+	for _, d := range successors {
+		if d.MediaType == v1.MediaTypeEmptyJSON {
+			continue
+		}
+		layerDescs = append(layerDescs, d)
+	}
+	if len(layerDescs) != len(layers) {
+		t.Fatalf("got %d layers, want %d", len(layerDescs), len(layers))
+	}
+
+	gotMediaTypes := make([]string, len(layerDescs))
+	for i, d := range layerDescs {
+		gotMediaTypes[i] = d.MediaType
+	}
+	sort.Strings(gotMediaTypes)
+	wantMediaTypes := []string{layers[0].MediaType, layers[1].MediaType}
+	sort.Strings(wantMediaTypes)
+	for i := range gotMediaTypes {
+		if gotMediaTypes[i] != wantMediaTypes[i] {
+			t.Errorf("layer media types = %v, want %v", gotMediaTypes, wantMediaTypes)
+		}
+	}
+
+	for i, d := range layerDescs {
+		rc, err := dst.Fetch(ctx, d)
+		if err != nil {
+			t.Fatalf("fetching layer %d: %v", i, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("reading layer %d: %v", i, err)
+		}
+		want, ok := wantContents[d.MediaType]
+		if !ok {
+			t.Fatalf("layer %d has unexpected media type %q", i, d.MediaType)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("layer %d content = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// registryConnection holds the TLS and credential settings that are shared between the ORAS provider and
+// the ORAS publisher, since both are just two directions of talking to the same registry.
+type registryConnection struct {
+	serverCAPath       string
+	clientCertPath     string
+	clientKeyPath      string
+	username           string
+	password           string
+	accessToken        string
+	refreshToken       string
+	plainHTTP          bool
+	insecureSkipVerify bool
+	credentialStore    CredentialStore
+}
+
+// newRegistry parses registryURL (which must have the "oci" scheme) and builds a *remote.Registry configured
+// according to conn.
+func newRegistry(registryURL string, conn registryConnection) (*remote.Registry, *url.URL, error) {
+	u, err := url.Parse(registryURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing registry URL: %w", err)
+	}
+	if u.Scheme != "oci" {
+		return nil, nil, fmt.Errorf("registry URL must have OCI scheme, got '%s'", u.Scheme)
+	}
+
+	registry, err := remote.NewRegistry(u.Host)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create ORAS client: %w", err)
+	}
+	registry.PlainHTTP = conn.plainHTTP
+
+	// the statically configured username/password/token fields are kept as a fallback default credential
+	// for the registry's own host, so that simple single-registry setups don't need a CredentialStore at
+	// all; a configured CredentialStore always takes precedence, and is the only way to get multi-host
+	// credentials. Credentials are resolved per registry host, not per repository.
+	fallback := staticCredentialStore{
+		u.Host: {
+			Username:     conn.username,
+			Password:     conn.password,
+			AccessToken:  conn.accessToken,
+			RefreshToken: conn.refreshToken,
+		},
+	}
+	store := conn.credentialStore
+	if store == nil {
+		store = fallback
+	} else {
+		store = NewChainCredentialStore(store, fallback)
+	}
+
+	creds := func(ctx context.Context, target string) (auth.Credential, error) {
+		return store.Credential(ctx, target)
+	}
+
+	rootCAs, err := caPool(conn.serverCAPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("configuring server CA: %w", err)
+	}
+	certs, err := clientCertificates(conn.clientCertPath, conn.clientKeyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("configuring client certificate: %w", err)
+	}
+
+	registry.Client = &auth.Client{
+		Credential: creds,
+		Cache:      auth.NewCache(),
+		Client: &http.Client{
+			Transport: &http.Transport{
+				// take proxy from the environment if set
+				Proxy: http.ProxyFromEnvironment,
+
+				// There are no connection timeouts
+				// so we are doing pretty much exactly what
+				// Go is doing itself
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+					// increasing this from the default Go settings
+					// as we can ensure that if there is IPv6 in our network
+					// it actually *must* be configured correctly.
+					FallbackDelay: 600 * time.Millisecond,
+				}).DialContext,
+
+				// These are HTTP keep alives (not TCP keepalives)
+				// and their corresponding idle connection settings and timeouts
+				DisableKeepAlives: false,
+				MaxIdleConns:      10,
+				MaxConnsPerHost:   3,
+				IdleConnTimeout:   90 * time.Second,
+
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+
+				// as we are setting our own DialContext and TLSClientConfig
+				// Go internally disables trying to use HTTP/2 (why?)
+				// so we are reenabling this here
+				ForceAttemptHTTP2: true,
+
+				// Our TLS configuration that we prepped before
+				TLSClientConfig: &tls.Config{
+					Rand:               rand.Reader,
+					Time:               time.Now,
+					RootCAs:            rootCAs,
+					Certificates:       certs,
+					MinVersion:         tls.VersionTLS12,
+					InsecureSkipVerify: conn.insecureSkipVerify,
+				},
+			},
+		},
+	}
+
+	return registry, u, nil
+}
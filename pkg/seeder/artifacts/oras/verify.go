@@ -0,0 +1,171 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"go.githedgehog.com/dasboot/pkg/log"
+	"go.uber.org/zap"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/file"
+)
+
+// defaultTag is used when an artifact reference does not pin a tag or digest.
+const defaultTag = "latest"
+
+// parseArtifactReference splits an artifact reference of the form
+// "name@sha256:<hex>" or "name:tag" into the repository-relative name and
+// the ref that should be resolved against the registry (a tag or a digest).
+// If neither a tag nor a digest is present, defaultTag is returned.
+func parseArtifactReference(artifact string) (name string, ref string, pinnedDigest digest.Digest, err error) {
+	if idx := strings.LastIndex(artifact, "@"); idx != -1 {
+		d, derr := digest.Parse(artifact[idx+1:])
+		if derr != nil {
+			return "", "", "", fmt.Errorf("parsing artifact digest: %w", derr)
+		}
+		return artifact[:idx], d.String(), d, nil
+	}
+	if idx := strings.LastIndex(artifact, ":"); idx != -1 {
+		return artifact[:idx], artifact[idx+1:], "", nil
+	}
+	return artifact, defaultTag, "", nil
+}
+
+// signatureTag derives the cosign-style signature tag for a manifest digest,
+// e.g. "sha256:abcd..." becomes "sha256-abcd....sig".
+func signatureTag(manifestDigest digest.Digest) string {
+	return strings.ReplaceAll(manifestDigest.String(), ":", "-") + ".sig"
+}
+
+// simpleSigningPayload is cosign's "simple signing" envelope: the bytes of this JSON document, not the
+// manifest digest itself, are what a signature layer's annotation actually signs. See
+// https://github.com/containers/image/blob/main/docs/atomic-signature.md, which cosign reuses as-is.
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// verifySignature resolves the cosign signature tag for manifestDigest in src, fetches the actual signed
+// payload blob for each signature layer, and checks whether at least one of them verifies against one of the
+// trusted verification keys and attests to manifestDigest. It returns an error if no valid signature is
+// found, which callers must treat as "refuse to serve". src is whatever the caller already resolved the
+// artifact's repository to, so this function itself never needs to know how to reach the registry.
+func verifySignature(ctx context.Context, src oras.ReadOnlyTarget, manifestDigest digest.Digest, keys []*ecdsa.PublicKey, fileStoreBasePath string) error {
+	sigFileStorePath, err := os.MkdirTemp(fileStoreBasePath, "oras-provider-sig-store-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary signature store: %w", err)
+	}
+	defer os.RemoveAll(sigFileStorePath)
+	sigStore, err := file.New(sigFileStorePath)
+	if err != nil {
+		return fmt.Errorf("creating signature file store: %w", err)
+	}
+
+	tag := signatureTag(manifestDigest)
+	sigManifestDesc, err := oras.Copy(ctx, src, tag, sigStore, tag, oras.DefaultCopyOptions)
+	if err != nil {
+		return fmt.Errorf("fetching signature manifest %q: %w", tag, err)
+	}
+
+	layers, err := content.Successors(ctx, sigStore, sigManifestDesc)
+	if err != nil {
+		return fmt.Errorf("fetching signature layers: %w", err)
+	}
+
+	for _, layer := range layers {
+		sigB64, ok := layer.Annotations["dev.cosignproject.cosign/signature"]
+		if !ok {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(sigB64)
+		if err != nil {
+			log.L().Warn("oras: skipping signature layer with invalid base64 signature annotation", zap.Error(err))
+			continue
+		}
+
+		// the layer content itself is the simple-signing payload that was actually signed, not the
+		// manifest digest - fetch and hash it rather than re-deriving what we expect it to say.
+		payloadRC, err := sigStore.Fetch(ctx, layer)
+		if err != nil {
+			log.L().Warn("oras: fetching signature payload blob failed", zap.Error(err))
+			continue
+		}
+		payload, err := io.ReadAll(payloadRC)
+		payloadRC.Close()
+		if err != nil {
+			log.L().Warn("oras: reading signature payload blob failed", zap.Error(err))
+			continue
+		}
+
+		var envelope simpleSigningPayload
+		if err := json.Unmarshal(payload, &envelope); err != nil {
+			log.L().Warn("oras: skipping signature layer with unparseable payload", zap.Error(err))
+			continue
+		}
+		if envelope.Critical.Image.DockerManifestDigest != manifestDigest.String() {
+			log.L().Warn("oras: skipping signature payload that attests to a different digest",
+				zap.String("attested", envelope.Critical.Image.DockerManifestDigest),
+				zap.String("wanted", manifestDigest.String()))
+			continue
+		}
+
+		payloadSum := sha256.Sum256(payload)
+		for _, key := range keys {
+			if ecdsa.VerifyASN1(key, payloadSum[:], sig) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("no valid signature found for %s", manifestDigest)
+}
+
+// loadECDSAPublicKey reads a PEM-encoded ECDSA public key from disk.
+func loadECDSAPublicKey(path string) (*ecdsa.PublicKey, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %q", path)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	ecdsaKey, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key in %q is not an ECDSA public key", path)
+	}
+	return ecdsaKey, nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oras
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/memory"
+)
+
+func TestParseArtifactReference(t *testing.T) {
+	validDigest := digest.FromString("hello").String()
+
+	tests := []struct {
+		name       string
+		artifact   string
+		wantName   string
+		wantRef    string
+		wantPinned digest.Digest
+		wantErr    bool
+	}{
+		{
+			name:       "tag",
+			artifact:   "nos/sonic:4.2.0",
+			wantName:   "nos/sonic",
+			wantRef:    "4.2.0",
+			wantPinned: "",
+		},
+		{
+			name:       "no ref defaults to latest",
+			artifact:   "nos/sonic",
+			wantName:   "nos/sonic",
+			wantRef:    defaultTag,
+			wantPinned: "",
+		},
+		{
+			name:       "digest",
+			artifact:   "nos/sonic@" + validDigest,
+			wantName:   "nos/sonic",
+			wantRef:    validDigest,
+			wantPinned: digest.Digest(validDigest),
+		},
+		{
+			name:     "malformed digest",
+			artifact: "nos/sonic@not-a-digest",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, ref, pinned, err := parseArtifactReference(tt.artifact)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseArtifactReference(%q): expected error, got none", tt.artifact)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseArtifactReference(%q): unexpected error: %v", tt.artifact, err)
+			}
+			if name != tt.wantName {
+				t.Errorf("name = %q, want %q", name, tt.wantName)
+			}
+			if ref != tt.wantRef {
+				t.Errorf("ref = %q, want %q", ref, tt.wantRef)
+			}
+			if pinned != tt.wantPinned {
+				t.Errorf("pinnedDigest = %q, want %q", pinned, tt.wantPinned)
+			}
+		})
+	}
+}
+
+func TestSignatureTag(t *testing.T) {
+	d := digest.FromString("hello")
+	got := signatureTag(d)
+	want := d.Algorithm().String() + "-" + d.Encoded() + ".sig"
+	if got != want {
+		t.Errorf("signatureTag(%q) = %q, want %q", d, got, want)
+	}
+}
+
+// pushSignature builds a cosign-style signature manifest for manifestDigest in store: a single layer holding
+// payload as its content, annotated with sig (base64 encoded), tagged under signatureTag(manifestDigest).
+func pushSignature(t *testing.T, store *memory.Store, manifestDigest digest.Digest, payload, sig []byte) {
+	t.Helper()
+	ctx := context.Background()
+
+	layerDesc := content.NewDescriptorFromBytes("application/vnd.dev.cosign.simplesigning.v1+json", payload)
+	layerDesc.Annotations = map[string]string{
+		"dev.cosignproject.cosign/signature": base64.StdEncoding.EncodeToString(sig),
+	}
+	if err := store.Push(ctx, layerDesc, bytes.NewReader(payload)); err != nil {
+		t.Fatalf("pushing signature layer: %v", err)
+	}
+
+	manifestDesc, err := oras.PackManifest(ctx, store, oras.PackManifestVersion1_1, "application/vnd.dev.cosign.artifact.sig.v1+json", oras.PackManifestOptions{
+		Layers: []v1.Descriptor{layerDesc},
+	})
+	if err != nil {
+		t.Fatalf("packing signature manifest: %v", err)
+	}
+
+	tag := signatureTag(manifestDigest)
+	if err := store.Tag(ctx, manifestDesc, tag); err != nil {
+		t.Fatalf("tagging signature manifest %q: %v", tag, err)
+	}
+}
+
+// signedPayload builds and signs a simple-signing envelope attesting to attestedDigest with key, returning
+// the raw payload bytes and the ASN.1 signature over its SHA-256 sum.
+func signedPayload(t *testing.T, key *ecdsa.PrivateKey, attestedDigest digest.Digest) (payload, sig []byte) {
+	t.Helper()
+
+	var envelope simpleSigningPayload
+	envelope.Critical.Type = "cosign container image signature"
+	envelope.Critical.Image.DockerManifestDigest = attestedDigest.String()
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("marshalling signature payload: %v", err)
+	}
+
+	sum := sha256.Sum256(payload)
+	sig, err = ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatalf("signing payload: %v", err)
+	}
+	return payload, sig
+}
+
+func TestVerifySignature(t *testing.T) {
+	ctx := context.Background()
+
+	trustedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating trusted key: %v", err)
+	}
+	untrustedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating untrusted key: %v", err)
+	}
+	trustedKeys := []*ecdsa.PublicKey{&trustedKey.PublicKey}
+	manifestDigest := digest.FromString("root-manifest")
+
+	t.Run("valid signature from trusted key is accepted", func(t *testing.T) {
+		store := memory.New()
+		payload, sig := signedPayload(t, trustedKey, manifestDigest)
+		pushSignature(t, store, manifestDigest, payload, sig)
+
+		if err := verifySignature(ctx, store, manifestDigest, trustedKeys, t.TempDir()); err != nil {
+			t.Errorf("verifySignature() = %v, want nil", err)
+		}
+	})
+
+	t.Run("signature from untrusted key is rejected", func(t *testing.T) {
+		store := memory.New()
+		payload, sig := signedPayload(t, untrustedKey, manifestDigest)
+		pushSignature(t, store, manifestDigest, payload, sig)
+
+		if err := verifySignature(ctx, store, manifestDigest, trustedKeys, t.TempDir()); err == nil {
+			t.Error("verifySignature() = nil, want error for untrusted key")
+		}
+	})
+
+	t.Run("tampered payload is rejected", func(t *testing.T) {
+		store := memory.New()
+		payload, sig := signedPayload(t, trustedKey, manifestDigest)
+		payload = append(payload, []byte(" ")...) // mutate the payload after it was signed
+		pushSignature(t, store, manifestDigest, payload, sig)
+
+		if err := verifySignature(ctx, store, manifestDigest, trustedKeys, t.TempDir()); err == nil {
+			t.Error("verifySignature() = nil, want error for tampered payload")
+		}
+	})
+
+	t.Run("payload attesting to a different digest is rejected", func(t *testing.T) {
+		store := memory.New()
+		otherDigest := digest.FromString("other-manifest")
+		payload, sig := signedPayload(t, trustedKey, otherDigest)
+		pushSignature(t, store, manifestDigest, payload, sig)
+
+		if err := verifySignature(ctx, store, manifestDigest, trustedKeys, t.TempDir()); err == nil {
+			t.Error("verifySignature() = nil, want error for digest mismatch")
+		}
+	})
+
+	t.Run("missing signature tag is rejected", func(t *testing.T) {
+		store := memory.New()
+
+		if err := verifySignature(ctx, store, manifestDigest, trustedKeys, t.TempDir()); err == nil {
+			t.Error("verifySignature() = nil, want error for missing signature tag")
+		}
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package artifacts defines the interfaces that the seeder uses to retrieve
+// installer and NOS artifacts from external stores.
+package artifacts
+
+import "io"
+
+// Provider abstracts retrieval of a named artifact. Implementations are free
+// to resolve the artifact name against whatever backing store they wrap (for
+// example an OCI registry). A nil return value indicates that the artifact
+// could not be retrieved, and implementations are expected to have logged the
+// reason already.
+type Provider interface {
+	// Get returns a reader for the requested artifact, or nil if it could
+	// not be retrieved. Callers are responsible for closing the returned
+	// ReadCloser.
+	Get(artifact string) io.ReadCloser
+}
@@ -0,0 +1,35 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package artifacts
+
+import "io"
+
+// PublishLayer is a single piece of content to be published as part of an artifact, e.g. the installer
+// binary, its generated embedded config, or a detached signature over it.
+type PublishLayer struct {
+	// MediaType identifies the content, e.g. one of the MediaType* constants in this package.
+	MediaType string
+
+	// Content is the layer's content. Publish reads it fully.
+	Content io.Reader
+}
+
+// Publisher is the inverse of Provider: it pushes artifacts to a backing store, keyed by an identity (e.g.
+// a switch serial number) rather than pulling them from one.
+type Publisher interface {
+	// Publish pushes layers as a single artifact addressed by identity, and returns the digest of the
+	// resulting manifest.
+	Publish(identity string, layers ...PublishLayer) (digest string, err error)
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"go.githedgehog.com/dasboot/pkg/log"
+	"go.uber.org/zap"
+)
+
+// loadCertAndKey reads a PEM certificate and PEM EC private key from disk.
+func loadCertAndKey(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("no PEM block in %q", certPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing certificate: %w", err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("no PEM block in %q", keyPath)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing key: %w", err)
+	}
+	return cert, key, nil
+}
+
+// writeCertAndKey persists a DER certificate and EC private key as PEM files with strict permissions.
+func writeCertAndKey(certPath, keyPath string, certDER []byte, key *ecdsa.PrivateKey) error {
+	certOut, err := os.OpenFile(certPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, certFilePerm)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", certPath, err)
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: certDER}); err != nil {
+		return fmt.Errorf("writing %q: %w", certPath, err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("marshaling key: %w", err)
+	}
+	keyOut, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, keyFilePerm)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", keyPath, err)
+	}
+	defer keyOut.Close()
+	if err := pem.Encode(keyOut, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}); err != nil {
+		return fmt.Errorf("writing %q: %w", keyPath, err)
+	}
+	return nil
+}
+
+// ServerCertificate returns a TLS certificate for serverName, minted by the intermediate CA. The result is
+// cached in memory and automatically re-minted once it is within RenewBefore of expiring.
+func (p *PKI) ServerCertificate(serverName string) (*tls.Certificate, error) {
+	return p.leafCertificate(serverName, []string{serverName}, p.cfg.ServerCertTTL, x509.ExtKeyUsageServerAuth)
+}
+
+// ConfigSigningCertificate returns the certificate used to sign embedded configuration payloads. It rotates
+// the same way ServerCertificate does.
+func (p *PKI) ConfigSigningCertificate() (*tls.Certificate, error) {
+	return p.leafCertificate("embedded-config-signer", nil, p.cfg.ServerCertTTL, x509.ExtKeyUsageCodeSigning)
+}
+
+// SignClientCSR signs a PKCS#10 certificate signing request submitted by an enrolling switch, and returns
+// the resulting leaf certificate. The switch generates and keeps its own private key; the CSR only carries
+// its public key, so the seeder never sees, generates, or transmits a client private key. The CommonName on
+// the returned certificate is always serial, regardless of what the CSR's Subject asked for, since serial is
+// what was actually authenticated out-of-band by the DeviceTokenValidator.
+func (p *PKI) SignClientCSR(csrDER []byte, serial string) (*x509.Certificate, error) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	serialNumber, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: serial},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(p.cfg.ClientCertTTL),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, p.intermediateCert, csr.PublicKey, p.intermediateKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing generated certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// RootCACertificate returns the root CA certificate, e.g. to hand out to clients as InstallerSettings.ServerCAPath.
+func (p *PKI) RootCACertificate() *x509.Certificate {
+	return p.rootCert
+}
+
+func (p *PKI) leafCertificate(cacheKey string, dnsNames []string, ttl time.Duration, extKeyUsage x509.ExtKeyUsage) (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cached, ok := p.leafCache[cacheKey]; ok {
+		if time.Until(cached.Leaf.NotAfter) > p.cfg.RenewBefore {
+			return cached, nil
+		}
+		log.L().Info("pki: rotating leaf certificate before expiry", zap.String("name", cacheKey), zap.Time("notAfter", cached.Leaf.NotAfter))
+	}
+
+	cert, err := p.mintLeaf(pkix.Name{CommonName: cacheKey}, dnsNames, ttl, extKeyUsage)
+	if err != nil {
+		return nil, err
+	}
+	if p.leafCache == nil {
+		p.leafCache = make(map[string]*tls.Certificate)
+	}
+	p.leafCache[cacheKey] = cert
+	return cert, nil
+}
+
+func (p *PKI) mintLeaf(subject pkix.Name, dnsNames []string, ttl time.Duration, extKeyUsage x509.ExtKeyUsage) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, p.intermediateCert, &key.PublicKey, p.intermediateKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing generated certificate: %w", err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certDER, p.intermediateCert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
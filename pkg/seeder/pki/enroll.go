@@ -0,0 +1,107 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pki
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+
+	"go.githedgehog.com/dasboot/pkg/log"
+	"go.uber.org/zap"
+)
+
+// DeviceTokenValidator authenticates an enrollment request out-of-band, e.g. against a token that was
+// provisioned into a switch at manufacturing time or handed out by an inventory system. Validate must
+// return an error if the token does not authorize serial to enroll.
+type DeviceTokenValidator interface {
+	Validate(ctx context.Context, serial, token string) error
+}
+
+// enrollRequest is the body a switch posts to the enrollment endpoint during stage0. The switch generates
+// its own key pair locally and submits a PKCS#10 certificate signing request for it; the seeder never
+// generates or sees a client private key, since this endpoint is reached over plain HTTP before the switch
+// has any certificate to protect the connection.
+type enrollRequest struct {
+	Serial string `json:"serial"`
+	Token  string `json:"token"`
+	// CSRPEM is a PEM-encoded PKCS#10 certificate signing request, generated and signed by the switch with
+	// a private key that never leaves it.
+	CSRPEM string `json:"csr_pem"`
+}
+
+// enrollResponse carries the signed client certificate back to the switch, along with the root CA so the
+// switch can validate the seeder going forward without any other out-of-band trust anchor. Only the leaf
+// certificate is included; the intermediate CA certificate that signed it is not. It
+// deliberately carries no private key material: the switch already holds the private key matching the CSR
+// it submitted.
+type enrollResponse struct {
+	CertificatePEM string `json:"certificate_pem"`
+	RootCAPEM      string `json:"root_ca_pem"`
+}
+
+// EnrollHandler returns an http.Handler implementing a small ACME-like enrollment endpoint: a switch posts
+// its serial number and device token, and on success receives a freshly minted client certificate. It is
+// meant to be mounted on the insecure stage0 server, since the switch has no client certificate yet and the
+// device token is what stands in for authentication.
+func (p *PKI) EnrollHandler(validator DeviceTokenValidator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req enrollRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Serial == "" || req.Token == "" || req.CSRPEM == "" {
+			http.Error(w, "serial, token and csr_pem are required", http.StatusBadRequest)
+			return
+		}
+
+		if err := validator.Validate(r.Context(), req.Serial, req.Token); err != nil {
+			log.L().Warn("pki: enrollment denied", zap.String("serial", req.Serial), zap.Error(err))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		csrBlock, _ := pem.Decode([]byte(req.CSRPEM))
+		if csrBlock == nil {
+			http.Error(w, "csr_pem does not contain a PEM block", http.StatusBadRequest)
+			return
+		}
+
+		cert, err := p.SignClientCSR(csrBlock.Bytes, req.Serial)
+		if err != nil {
+			log.L().Warn("pki: signing certificate request failed", zap.String("serial", req.Serial), zap.Error(err))
+			http.Error(w, "invalid certificate request", http.StatusBadRequest)
+			return
+		}
+
+		resp := enrollResponse{
+			CertificatePEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+			RootCAPEM:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.rootCert.Raw})),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&resp); err != nil {
+			log.L().Error("pki: encoding enrollment response failed", zap.String("serial", req.Serial), zap.Error(err))
+		}
+		log.L().Info("pki: device enrolled", zap.String("serial", req.Serial))
+	})
+}
@@ -0,0 +1,246 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubValidator is a DeviceTokenValidator that accepts exactly one serial/token pair and rejects everything
+// else, so tests can exercise both the accept and deny paths without a real device inventory.
+type stubValidator struct {
+	wantSerial, wantToken string
+}
+
+func (v stubValidator) Validate(_ context.Context, serial, token string) error {
+	if serial == v.wantSerial && token == v.wantToken {
+		return nil
+	}
+	return errors.New("unknown serial or token")
+}
+
+func csrPEM(t *testing.T, commonName string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating switch key: %v", err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		t.Fatalf("creating CSR: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))
+}
+
+func postEnroll(t *testing.T, handler http.Handler, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshalling request body: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/enroll", bytes.NewReader(b))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestEnrollHandlerHappyPath(t *testing.T) {
+	p := newTestPKI(t)
+	validator := stubValidator{wantSerial: "switch-serial-123", wantToken: "correct-token"}
+	handler := p.EnrollHandler(validator)
+
+	rec := postEnroll(t, handler, enrollRequest{
+		Serial: "switch-serial-123",
+		Token:  "correct-token",
+		CSRPEM: csrPEM(t, "whatever-the-switch-asked-for"),
+	})
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d, body: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var resp enrollResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshalling response: %v", err)
+	}
+
+	certBlock, _ := pem.Decode([]byte(resp.CertificatePEM))
+	if certBlock == nil {
+		t.Fatalf("certificate_pem does not contain a PEM block")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		t.Fatalf("parsing issued certificate: %v", err)
+	}
+	if cert.Subject.CommonName != "switch-serial-123" {
+		t.Errorf("CommonName = %q, want the validated serial", cert.Subject.CommonName)
+	}
+	if err := cert.CheckSignatureFrom(p.intermediateCert); err != nil {
+		t.Errorf("issued certificate is not signed by the intermediate CA: %v", err)
+	}
+
+	rootBlock, _ := pem.Decode([]byte(resp.RootCAPEM))
+	if rootBlock == nil {
+		t.Fatalf("root_ca_pem does not contain a PEM block")
+	}
+	rootCert, err := x509.ParseCertificate(rootBlock.Bytes)
+	if err != nil {
+		t.Fatalf("parsing root CA certificate: %v", err)
+	}
+	if !rootCert.Equal(p.rootCert) {
+		t.Errorf("root_ca_pem does not match the PKI's root certificate")
+	}
+
+	// the switch generated its own key pair, so the response must never carry any private key material
+	if strings.Contains(rec.Body.String(), "PRIVATE KEY") {
+		t.Errorf("enrollment response leaked a private key: %s", rec.Body.String())
+	}
+}
+
+func TestEnrollHandlerRejectsInvalidToken(t *testing.T) {
+	p := newTestPKI(t)
+	validator := stubValidator{wantSerial: "switch-serial-123", wantToken: "correct-token"}
+	handler := p.EnrollHandler(validator)
+
+	rec := postEnroll(t, handler, enrollRequest{
+		Serial: "switch-serial-123",
+		Token:  "wrong-token",
+		CSRPEM: csrPEM(t, "switch"),
+	})
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestEnrollHandlerRejectsMissingFields(t *testing.T) {
+	p := newTestPKI(t)
+	validator := stubValidator{wantSerial: "switch-serial-123", wantToken: "correct-token"}
+	handler := p.EnrollHandler(validator)
+
+	tests := []struct {
+		name string
+		req  enrollRequest
+	}{
+		{
+			name: "missing serial",
+			req:  enrollRequest{Token: "correct-token", CSRPEM: csrPEM(t, "switch")},
+		},
+		{
+			name: "missing token",
+			req:  enrollRequest{Serial: "switch-serial-123", CSRPEM: csrPEM(t, "switch")},
+		},
+		{
+			name: "missing csr_pem",
+			req:  enrollRequest{Serial: "switch-serial-123", Token: "correct-token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postEnroll(t, handler, tt.req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestEnrollHandlerRejectsMalformedBody(t *testing.T) {
+	p := newTestPKI(t)
+	handler := p.EnrollHandler(stubValidator{wantSerial: "s", wantToken: "t"})
+
+	req := httptest.NewRequest(http.MethodPost, "/enroll", bytes.NewReader([]byte("not json")))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestEnrollHandlerRejectsInvalidCSRPEM(t *testing.T) {
+	p := newTestPKI(t)
+	validator := stubValidator{wantSerial: "switch-serial-123", wantToken: "correct-token"}
+	handler := p.EnrollHandler(validator)
+
+	rec := postEnroll(t, handler, enrollRequest{
+		Serial: "switch-serial-123",
+		Token:  "correct-token",
+		CSRPEM: "not a PEM block",
+	})
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestEnrollHandlerRejectsCSRWithInvalidSignature(t *testing.T) {
+	p := newTestPKI(t)
+	validator := stubValidator{wantSerial: "switch-serial-123", wantToken: "correct-token"}
+	handler := p.EnrollHandler(validator)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating switch key: %v", err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "switch"},
+	}, key)
+	if err != nil {
+		t.Fatalf("creating CSR: %v", err)
+	}
+	corrupted := append([]byte(nil), csrDER...)
+	corrupted[len(corrupted)/2] ^= 0xFF
+	badCSRPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: corrupted}))
+
+	rec := postEnroll(t, handler, enrollRequest{
+		Serial: "switch-serial-123",
+		Token:  "correct-token",
+		CSRPEM: badCSRPEM,
+	})
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestEnrollHandlerRejectsWrongMethod(t *testing.T) {
+	p := newTestPKI(t)
+	handler := p.EnrollHandler(stubValidator{wantSerial: "s", wantToken: "t"})
+
+	req := httptest.NewRequest(http.MethodGet, "/enroll", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
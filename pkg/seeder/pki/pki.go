@@ -0,0 +1,195 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pki implements a small, embedded PKI for the seeder, inspired by Smallstep's and Caddy's embedded
+// CA applications. When enabled, it removes the need for an operator to pre-provision the seeder's server
+// and embedded-config signing certificates by hand: a root CA and an intermediate are generated (or loaded,
+// on subsequent starts) on first use, leaf certificates are minted and rotated automatically, and switches
+// can enroll for their own client certificate over a small ACME-like HTTP endpoint.
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.githedgehog.com/dasboot/pkg/log"
+	"go.uber.org/zap"
+)
+
+const (
+	rootCertFile         = "root-ca-cert.pem"
+	rootKeyFile          = "root-ca-key.pem"
+	intermediateCertFile = "intermediate-ca-cert.pem"
+	intermediateKeyFile  = "intermediate-ca-key.pem"
+
+	dataDirPerm  = 0o700
+	keyFilePerm  = 0o600
+	certFilePerm = 0o644
+
+	// defaultRootTTL and defaultIntermediateTTL are generous because rotating a root or intermediate
+	// requires redistributing trust, unlike leaf certificates which rotate transparently.
+	defaultRootTTL         = 10 * 365 * 24 * time.Hour
+	defaultIntermediateTTL = 5 * 365 * 24 * time.Hour
+)
+
+// Config configures an embedded PKI instance. It corresponds to the `PKI` block in the seeder's Config.
+type Config struct {
+	// DataDir is where the root CA, intermediate CA, and their keys are persisted. It must be writable,
+	// and will be created with strict permissions if it does not exist yet.
+	DataDir string `json:"data_dir,omitempty" yaml:"data_dir,omitempty"`
+
+	// ServerCertTTL is how long minted server leaf certificates are valid for. Defaults to 30 days.
+	ServerCertTTL time.Duration `json:"server_cert_ttl,omitempty" yaml:"server_cert_ttl,omitempty"`
+
+	// ClientCertTTL is how long certificates minted for enrolling switches are valid for. Defaults to 90
+	// days.
+	ClientCertTTL time.Duration `json:"client_cert_ttl,omitempty" yaml:"client_cert_ttl,omitempty"`
+
+	// RenewBefore is how long before a leaf certificate's expiry it is rotated. Defaults to a third of
+	// its TTL.
+	RenewBefore time.Duration `json:"renew_before,omitempty" yaml:"renew_before,omitempty"`
+}
+
+// PKI is an embedded certificate authority that mints and rotates the certificates the seeder needs, and
+// that issues client certificates to enrolling switches.
+type PKI struct {
+	cfg Config
+
+	mu               sync.Mutex
+	rootCert         *x509.Certificate
+	rootKey          *ecdsa.PrivateKey
+	intermediateCert *x509.Certificate
+	intermediateKey  *ecdsa.PrivateKey
+	leafCache        map[string]*tls.Certificate
+}
+
+// New loads the root and intermediate CA from cfg.DataDir, generating them on first use. The returned PKI
+// is ready to mint leaf certificates.
+func New(cfg Config) (*PKI, error) {
+	if cfg.DataDir == "" {
+		return nil, fmt.Errorf("pki: DataDir must not be empty")
+	}
+	if cfg.ServerCertTTL == 0 {
+		cfg.ServerCertTTL = 30 * 24 * time.Hour
+	}
+	if cfg.ClientCertTTL == 0 {
+		cfg.ClientCertTTL = 90 * 24 * time.Hour
+	}
+	if cfg.RenewBefore == 0 {
+		cfg.RenewBefore = cfg.ServerCertTTL / 3
+	}
+
+	if err := os.MkdirAll(cfg.DataDir, dataDirPerm); err != nil {
+		return nil, fmt.Errorf("pki: creating data dir: %w", err)
+	}
+
+	p := &PKI{cfg: cfg}
+
+	var err error
+	p.rootCert, p.rootKey, err = loadOrGenerateCA(
+		filepath.Join(cfg.DataDir, rootCertFile),
+		filepath.Join(cfg.DataDir, rootKeyFile),
+		pkix.Name{CommonName: "DAS BOOT Root CA"},
+		defaultRootTTL,
+		nil, nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("pki: root CA: %w", err)
+	}
+
+	p.intermediateCert, p.intermediateKey, err = loadOrGenerateCA(
+		filepath.Join(cfg.DataDir, intermediateCertFile),
+		filepath.Join(cfg.DataDir, intermediateKeyFile),
+		pkix.Name{CommonName: "DAS BOOT Intermediate CA"},
+		defaultIntermediateTTL,
+		p.rootCert, p.rootKey,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("pki: intermediate CA: %w", err)
+	}
+
+	return p, nil
+}
+
+// loadOrGenerateCA loads a CA certificate and key from certPath/keyPath if both exist, or generates a new
+// self-signed (if parent is nil) or parent-signed CA otherwise and persists it. If both exist but cannot be
+// loaded, an error is returned and the existing files are left untouched.
+func loadOrGenerateCA(certPath, keyPath string, subject pkix.Name, ttl time.Duration, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	if cert, key, err := loadCertAndKey(certPath, keyPath); err == nil {
+		log.L().Info("pki: loaded existing CA", zap.String("subject", subject.CommonName), zap.String("cert", certPath))
+		return cert, key, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("loading existing CA from %q: %w", certPath, err)
+	}
+
+	log.L().Info("pki: generating new CA", zap.String("subject", subject.CommonName))
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(ttl),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent, parentKey
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing generated certificate: %w", err)
+	}
+
+	if err := writeCertAndKey(certPath, keyPath, certDER, key); err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 Hedgehog
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestPKI(t *testing.T) *PKI {
+	t.Helper()
+	p, err := New(Config{
+		DataDir:       t.TempDir(),
+		ServerCertTTL: time.Hour,
+		ClientCertTTL: time.Hour,
+		RenewBefore:   30 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return p
+}
+
+func TestNewGeneratesAndPersistsCAs(t *testing.T) {
+	dataDir := t.TempDir()
+	p, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if !p.rootCert.IsCA {
+		t.Errorf("root certificate is not marked as a CA")
+	}
+	if !p.intermediateCert.IsCA {
+		t.Errorf("intermediate certificate is not marked as a CA")
+	}
+	if err := p.intermediateCert.CheckSignatureFrom(p.rootCert); err != nil {
+		t.Errorf("intermediate certificate is not signed by the root: %v", err)
+	}
+
+	// a second PKI pointed at the same DataDir must load the same CAs rather than generating new ones
+	p2, err := New(Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatalf("New (reload): %v", err)
+	}
+	if !p.rootCert.Equal(p2.rootCert) {
+		t.Errorf("reloaded root certificate differs from the generated one")
+	}
+	if !p.intermediateCert.Equal(p2.intermediateCert) {
+		t.Errorf("reloaded intermediate certificate differs from the generated one")
+	}
+}
+
+func TestServerCertificateCachesUntilRenewal(t *testing.T) {
+	p := newTestPKI(t)
+
+	cert1, err := p.ServerCertificate("seeder.example.com")
+	if err != nil {
+		t.Fatalf("ServerCertificate: %v", err)
+	}
+	cert2, err := p.ServerCertificate("seeder.example.com")
+	if err != nil {
+		t.Fatalf("ServerCertificate: %v", err)
+	}
+	if cert1.Leaf.SerialNumber.Cmp(cert2.Leaf.SerialNumber) != 0 {
+		t.Errorf("ServerCertificate minted a new certificate on second call, want cached one")
+	}
+
+	// force the cached certificate to look like it is within RenewBefore of expiring
+	p.mu.Lock()
+	cached := p.leafCache["seeder.example.com"]
+	cached.Leaf.NotAfter = time.Now().Add(p.cfg.RenewBefore - time.Minute)
+	p.mu.Unlock()
+
+	cert3, err := p.ServerCertificate("seeder.example.com")
+	if err != nil {
+		t.Fatalf("ServerCertificate (after forced near-expiry): %v", err)
+	}
+	if cert1.Leaf.SerialNumber.Cmp(cert3.Leaf.SerialNumber) == 0 {
+		t.Errorf("ServerCertificate did not rotate a near-expiry certificate")
+	}
+}
+
+func TestSignClientCSR(t *testing.T) {
+	p := newTestPKI(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating switch key: %v", err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "whatever-the-switch-asked-for"},
+	}, key)
+	if err != nil {
+		t.Fatalf("creating CSR: %v", err)
+	}
+
+	cert, err := p.SignClientCSR(csrDER, "switch-serial-123")
+	if err != nil {
+		t.Fatalf("SignClientCSR: %v", err)
+	}
+
+	if cert.Subject.CommonName != "switch-serial-123" {
+		t.Errorf("CommonName = %q, want the validated serial, not whatever the CSR asked for", cert.Subject.CommonName)
+	}
+	if err := cert.CheckSignatureFrom(p.intermediateCert); err != nil {
+		t.Errorf("issued certificate is not signed by the intermediate CA: %v", err)
+	}
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || !pub.Equal(&key.PublicKey) {
+		t.Errorf("issued certificate does not carry the switch's own public key")
+	}
+}
+
+func TestSignClientCSRRejectsInvalidSignature(t *testing.T) {
+	p := newTestPKI(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating switch key: %v", err)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "switch"},
+	}, key)
+	if err != nil {
+		t.Fatalf("creating CSR: %v", err)
+	}
+	// corrupt a byte in the middle of the DER to invalidate the self-signature without making it fail to
+	// parse outright
+	corrupted := append([]byte(nil), csrDER...)
+	corrupted[len(corrupted)/2] ^= 0xFF
+
+	if _, err := p.SignClientCSR(corrupted, "switch"); err == nil {
+		t.Errorf("SignClientCSR accepted a CSR with an invalid signature")
+	}
+}
+
+func TestLoadOrGenerateCAPath(t *testing.T) {
+	dataDir := t.TempDir()
+	certPath := filepath.Join(dataDir, "ca-cert.pem")
+	keyPath := filepath.Join(dataDir, "ca-key.pem")
+
+	cert, _, err := loadOrGenerateCA(certPath, keyPath, pkix.Name{CommonName: "Test CA"}, time.Hour, nil, nil)
+	if err != nil {
+		t.Fatalf("loadOrGenerateCA: %v", err)
+	}
+	if !cert.IsCA {
+		t.Errorf("generated certificate is not marked as a CA")
+	}
+
+	reloaded, _, err := loadOrGenerateCA(certPath, keyPath, pkix.Name{CommonName: "Test CA"}, time.Hour, nil, nil)
+	if err != nil {
+		t.Fatalf("loadOrGenerateCA (reload): %v", err)
+	}
+	if !cert.Equal(reloaded) {
+		t.Errorf("reloaded certificate differs from the generated one")
+	}
+}